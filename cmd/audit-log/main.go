@@ -0,0 +1,171 @@
+// Command audit-log replays a directory's transparency log, verifying every entry against the log's latest checkpoint
+// and checking that every logged prefix tree root matches the tree recomputed from the logged labels and commitments.
+//
+// With -server, it also fetches the history of each key given by -id from the directory's API, and verifies it with the
+// directory's VRF key, checking that its root was logged as of the checkpoint.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"iter"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"filippo.io/torchwood/prefix"
+	"github.com/codahale/keydonkey/internal/akd"
+	"github.com/codahale/keydonkey/internal/logreader"
+	"github.com/codahale/keydonkey/internal/server"
+	"github.com/codahale/keydonkey/internal/storage"
+	"github.com/codahale/keydonkey/internal/vrf"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func main() {
+	logURL := flag.String("log", "", "the directory or http(s) URL of the log")
+	vkey := flag.String("vkey", "", "the verifier key of the log")
+	serverURL := flag.String("server", "", "the http(s) URL of the directory's API, from which to audit key histories")
+	var ids []string
+	flag.Func("id", "the ID of a key whose history to audit (may be repeated)", func(id string) error {
+		ids = append(ids, id)
+		return nil
+	})
+	flag.Parse()
+
+	if *logURL == "" || *vkey == "" || (len(ids) > 0 && *serverURL == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	verifier, err := note.NewVerifier(*vkey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f := logreader.NewFileFetcher(*logURL)
+	if strings.HasPrefix(*logURL, "http://") || strings.HasPrefix(*logURL, "https://") {
+		f, err = logreader.NewHTTPFetcher(*logURL, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	r := logreader.NewReader(f, verifier)
+	cp, err := r.Checkpoint(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The replayed root entries are kept to check the roots of the audited histories.
+	roots := make(map[uint64]storage.LogRoot)
+	entries := func(yield func(logreader.Entry, error) bool) {
+		for e, err := range r.Entries(ctx, cp, 0) {
+			if err == nil && e.Type == logreader.RootEntry && len(ids) > 0 {
+				roots[e.Index] = e.Root
+			}
+			if !yield(e, err) {
+				return
+			}
+		}
+	}
+
+	stats, err := logreader.Replay(ctx, iter.Seq2[logreader.Entry, error](entries), prefix.NewMemoryStorage())
+	if err != nil {
+		log.Fatalf("replayed %d keys and %d roots before failing: %v", stats.Keys, stats.Roots, err)
+	}
+
+	fmt.Printf("verified %d entries: %d keys, %d roots\n", cp.Size, stats.Keys, stats.Roots)
+
+	if len(ids) == 0 {
+		return
+	}
+
+	vk, err := fetchVerifyingKey(ctx, *serverURL, *vkey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, id := range ids {
+		if err := auditHistory(ctx, *serverURL, id, vk, cp.Size, roots); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// fetchVerifyingKey fetches the directory's VRF key from its API, checking that the API serves the given log verifier
+// key. As the key verifies every audited proof, a table is precomputed for it.
+func fetchVerifyingKey(ctx context.Context, serverURL, vkey string) (*vrf.VerifyingKey, error) {
+	var res server.VerifyingKeyResponse
+	if err := getJSON(ctx, serverURL+"/v1/verifying-key", &res); err != nil {
+		return nil, err
+	}
+	if res.LogKey != vkey {
+		return nil, fmt.Errorf("server's log key is %q, not %q", res.LogKey, vkey)
+	}
+
+	return vrf.ParseJWKVerifyingKey(res.VRFKey, vrf.WithStrictKey(), vrf.WithPrecomputedTable())
+}
+
+// auditHistory fetches the history of the given ID from the directory's API and verifies it. If its root was logged
+// within the first size entries of the log, whose root entries are given, it is checked against the logged root.
+func auditHistory(ctx context.Context, serverURL, id string, vk *vrf.VerifyingKey, size uint64, roots map[uint64]storage.LogRoot) error {
+	var res server.HistoryResponse
+	if err := getJSON(ctx, serverURL+"/v1/history?id="+url.QueryEscape(id), &res); err != nil {
+		return err
+	}
+
+	results, err := res.History()
+	if err != nil {
+		return fmt.Errorf("history of %q: %w", id, err)
+	}
+	if len(results) == 0 {
+		fmt.Printf("history of %q is empty\n", id)
+		return nil
+	}
+
+	var logged *storage.LogRoot
+	if results[0].Epoch != 0 && results[0].RootLogIndex < size {
+		root, ok := roots[results[0].RootLogIndex]
+		if !ok {
+			return fmt.Errorf("history of %q has root log index %d, which is not a root entry", id, results[0].RootLogIndex)
+		}
+		logged = &root
+	}
+	if !akd.VerifyHistory(vk, results, logged) {
+		return fmt.Errorf("history of %q did not verify", id)
+	}
+
+	if logged == nil {
+		fmt.Printf("verified %d versions of %q, whose root was not logged as of the checkpoint\n", len(results), id)
+	} else {
+		fmt.Printf("verified %d versions of %q in epoch %d\n", len(results), id, logged.Epoch)
+	}
+	return nil
+}
+
+// getJSON fetches the given URL and decodes its JSON response into res.
+func getJSON(ctx context.Context, target string, res any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		var e server.ErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("GET %s: %s: %s", target, resp.Status, e.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
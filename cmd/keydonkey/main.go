@@ -0,0 +1,144 @@
+// Command keydonkey opens a directory and serves its JSON-over-HTTP API, with which clients publish and look up keys,
+// list the history of a key, and fetch the directory's verifying keys and log checkpoints. On SIGINT or SIGTERM, it
+// stops accepting connections, waits for in-flight requests to finish, and closes the directory.
+//
+// With -keyholder, the directory's VRF proofs and commitment openings are created by a keyholder process, so the
+// directory's private key is never loaded; the log's checkpoints are then signed with the separate key given by
+// -log-key.
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/codahale/keydonkey/internal/akd"
+	"github.com/codahale/keydonkey/internal/keyholder"
+	"github.com/codahale/keydonkey/internal/server"
+	"github.com/codahale/keydonkey/internal/storage"
+	"github.com/codahale/keydonkey/internal/vrf"
+)
+
+func main() {
+	dir := flag.String("dir", "", "the path of the directory's storage")
+	keyFile := flag.String("key", "", "the PEM or JWK file containing the directory's private key and VRF suite")
+	keyHolder := flag.String("keyholder", "", "the Unix socket of a key holder which holds the directory's private key, in place of -key")
+	logKeyFile := flag.String("log-key", "", "the PEM or JWK file containing the private key which signs the log's checkpoints (default -key)")
+	listen := flag.String("listen", "localhost:8080", "the address to listen on")
+	origin := flag.String("origin", akd.DefaultOrigin, "the origin of the directory's transparency log")
+	packNodes := flag.Bool("pack-nodes", false, "store the prefix tree in packs rather than individual files")
+	rootLogging := flag.Bool("root-logging", false, "log the prefix tree's root after each publish")
+	logIntegration := flag.Bool("log-integration", false, "wait for each published key to be covered by a checkpoint")
+	antispam := flag.Bool("antispam", false, "deduplicate the transparency log's entries")
+	timeout := flag.Duration("timeout", server.DefaultTimeout, "the deadline of each request's directory operation")
+	flag.Parse()
+
+	if *dir == "" || (*keyFile == "") == (*keyHolder == "") || (*keyHolder != "" && *logKeyFile == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Once shutdown has started, a second signal kills the process.
+	context.AfterFunc(ctx, stop)
+
+	opts := akd.Options{
+		Origin:         *origin,
+		PackNodes:      *packNodes,
+		RootLogging:    *rootLogging,
+		LogIntegration: *logIntegration,
+		Antispam:       *antispam,
+	}
+	if *keyFile != "" {
+		privateKey, suite, err := vrf.LoadPrivateKey(*keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.PrivateKey, opts.VRFSuite = privateKey, suite
+	} else {
+		client, err := keyholder.Dial(ctx, *keyHolder)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() { _ = client.Close() }()
+		opts.KeyHolder = client
+	}
+	if *logKeyFile != "" {
+		logPrivateKey, _, err := vrf.LoadPrivateKey(*logKeyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.LogPrivateKey = logPrivateKey
+	} else {
+		opts.LogPrivateKey = opts.PrivateKey
+	}
+
+	logKey, err := storage.EncodeVerifierKey(*origin, opts.LogPrivateKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	d, shutdown, err := akd.Open(ctx, *dir, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	h, err := server.NewHandler(d, logKey, *timeout)
+	if err != nil {
+		_ = shutdown(context.Background())
+		log.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		_ = shutdown(context.Background())
+		log.Fatal(err)
+	}
+
+	log.Printf("serving %s on %s", *dir, l.Addr())
+	if err := serve(ctx, l, h, *timeout, shutdown); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve serves the given handler on the given listener until the context is done. It then stops accepting connections,
+// waits for in-flight requests to finish, and shuts down the directory. If serving fails, the directory is shut down
+// and the error is returned.
+func serve(ctx context.Context, l net.Listener, h http.Handler, timeout time.Duration, shutdown func(context.Context) error) error {
+	srv := &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      timeout + 10*time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    64 * 1024,
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-errc:
+		_ = shutdown(context.Background())
+		return err
+	case <-ctx.Done():
+	}
+
+	// Shutdown returns once in-flight requests have finished, after which the directory can be closed.
+	log.Print("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout+10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Print(err)
+	}
+	return shutdown(shutdownCtx)
+}
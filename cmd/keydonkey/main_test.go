@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServeShutdown(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The handler blocks until it is released, so that shutdown starts while a request is in flight.
+	started, release := make(chan struct{}), make(chan struct{})
+	var finished atomic.Bool
+	h := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+		finished.Store(true)
+		_, _ = io.WriteString(w, "ok")
+	})
+
+	var closedAfterRequest atomic.Bool
+	shutdown := func(context.Context) error {
+		closedAfterRequest.Store(finished.Load())
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve(ctx, l, h, time.Second, shutdown)
+	}()
+
+	respc := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			respc <- err.Error()
+			return
+		}
+		defer func() { _ = resp.Body.Close() }()
+		b, _ := io.ReadAll(resp.Body)
+		respc <- string(b)
+	}()
+
+	<-started
+	cancel()
+
+	// New connections are refused once shutdown has started.
+	for {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			break
+		}
+		_ = c.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case err := <-errc:
+		t.Fatalf("serve returned %v before the in-flight request finished", err)
+	default:
+	}
+
+	close(release)
+	if got, want := <-respc, "ok"; got != want {
+		t.Errorf("response = %q, want %q", got, want)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if !closedAfterRequest.Load() {
+		t.Error("directory was shut down before the in-flight request finished")
+	}
+}
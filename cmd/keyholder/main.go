@@ -0,0 +1,97 @@
+// Command keyholder holds a directory's private key and serves its VRF proofs and commitment openings on a Unix socket,
+// so that the directory's process never loads the key. The socket must be placed in a directory which can't be accessed
+// by the owner's group or by others, so that no other user can connect to it.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/codahale/keydonkey/internal/akd"
+	"github.com/codahale/keydonkey/internal/keyholder"
+	"github.com/codahale/keydonkey/internal/vrf"
+)
+
+func main() {
+	keyFile := flag.String("key", "", "the PEM or JWK file containing the directory's private key and VRF suite")
+	socket := flag.String("socket", "", "the path of the Unix socket to listen on")
+	flag.Parse()
+
+	if *keyFile == "" || *socket == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	privateKey, suite, err := vrf.LoadPrivateKey(*keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The key holder keeps only the keys derived from the private key, which isn't needed afterwards.
+	kh, err := akd.NewKeyHolder(privateKey, suite)
+	clear(privateKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The socket is only reachable through its directory, so checking the directory before listening leaves no window
+	// in which another user can connect.
+	if err := checkSocketDir(filepath.Dir(*socket)); err != nil {
+		log.Fatal(err)
+	}
+
+	l, err := net.Listen("unix", *socket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Chmod(*socket, 0600); err != nil {
+		_ = l.Close()
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{
+		Handler:           keyholder.NewHandler(kh),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("serving %v key holder on %s", suite, *socket)
+	if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// checkSocketDir returns an error if the given directory isn't a directory or, on Unix systems, can be accessed by the
+// owner's group or by others.
+func checkSocketDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if perm := info.Mode().Perm(); runtime.GOOS != "windows" && perm&0o077 != 0 {
+		return fmt.Errorf("%s has permissions %#o, which allow access by other users", dir, perm)
+	}
+	return nil
+}
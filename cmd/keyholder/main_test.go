@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckSocketDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSocketDir(dir); err != nil {
+		t.Errorf("checkSocketDir(0700) = %v, want nil", err)
+	}
+
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSocketDir(dir); err == nil {
+		t.Error("accepted a directory which other users can access")
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSocketDir(file); err == nil {
+		t.Error("accepted a file")
+	}
+}
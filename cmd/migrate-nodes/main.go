@@ -0,0 +1,35 @@
+// Command migrate-nodes rewrites the legacy JSON prefix tree nodes of an on-disk directory in the binary node
+// encoding. The directory must not be in use while the migration runs.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/codahale/keydonkey/internal/storage"
+)
+
+func main() {
+	dir := flag.String("dir", "", "the directory containing the nodes directory")
+	flag.Parse()
+
+	if *dir == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	root, err := os.OpenRoot(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = root.Close() }()
+
+	n, err := storage.MigrateFSNodeStore(root)
+	if err != nil {
+		log.Fatalf("migrated %d nodes before failing: %v", n, err)
+	}
+
+	fmt.Printf("migrated %d nodes\n", n)
+}
@@ -3,93 +3,245 @@ package akd
 import (
 	"context"
 	"crypto/ed25519"
-	"crypto/hkdf"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
 
 	"filippo.io/torchwood/prefix"
 	"github.com/codahale/keydonkey/internal/storage"
 	"github.com/codahale/keydonkey/internal/vrf"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/mod/sumdb/note"
 )
 
 type Directory struct {
-	pk   *vrf.ProvingKey
-	ck   []byte
-	keys storage.KeyStore
-	log  storage.LogStore
-	tree *prefix.Tree
+	kh        KeyHolder
+	vk        *vrf.VerifyingKey
+	keys      storage.KeyStore
+	log       storage.LogStore
+	tree      *prefix.Tree
+	integrate bool
+	logRoots  bool
+	vrfSuite  vrf.Suite
+	tracer    trace.Tracer
+
+	// mu serializes updates to the tree, the log, and the key store, so that concurrent publishes neither lose each
+	// other's insertions nor interleave their log entries. It also guards root and rootIndex, which record the latest
+	// root entry, once it has been loaded.
+	mu         sync.RWMutex
+	root       *storage.LogRoot
+	rootIndex  uint64
+	rootLoaded bool
 }
 
-func NewDirectory(privateKey ed25519.PrivateKey, keys storage.KeyStore, nodes storage.NodeStore, log storage.LogStore) (*Directory, error) {
+// Option configures a Directory.
+type Option func(*Directory)
+
+// WithLogIntegration makes Publish wait until each new transparency log entry is covered by a signed checkpoint, and
+// include the checkpoint and an inclusion proof in its result. The directory's LogStore must implement
+// storage.LogIntegrator.
+func WithLogIntegration() Option {
+	return func(d *Directory) {
+		d.integrate = true
+	}
+}
+
+// WithVRFSuite selects the cipher suite of the directory's VRF proofs. By default, vrf.ELL2 is used. The suite must not
+// change for the life of the directory, as it determines the labels of the prefix tree. With NewDirectoryWithKeyHolder,
+// the suite is that of the key holder's verifying key, and it is an error to select another.
+func WithVRFSuite(suite vrf.Suite) Option {
+	return func(d *Directory) {
+		d.vrfSuite = suite
+	}
+}
+
+// WithTracerProvider makes the directory record spans for its operations with the given TracerProvider. By default,
+// the global TracerProvider is used.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(d *Directory) {
+		d.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// WithRootLogging makes Publish append a root entry recording the epoch, time, and root hash of the prefix tree to the
+// transparency log after each key entry, so that clients can check that the roots they are served have been logged.
+// Each Publish starts a new epoch. The directory's LogStore must implement
+// storage.RootLogger.
+func WithRootLogging() Option {
+	return func(d *Directory) {
+		d.logRoots = true
+	}
+}
+
+func NewDirectory(privateKey ed25519.PrivateKey, keys storage.KeyStore, nodes storage.NodeStore, log storage.LogStore, opts ...Option) (*Directory, error) {
+	d, err := newDirectory(keys, nodes, log, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.vrfSuite == 0 {
+		d.vrfSuite = vrf.ELL2
+	}
+
+	d.kh, err = NewKeyHolder(privateKey, d.vrfSuite)
+	if err != nil {
+		return nil, err
+	}
+	d.vk = d.kh.VerifyingKey().Precompute()
+
+	return d, nil
+}
+
+// NewDirectoryWithKeyHolder returns a directory whose VRF proofs and commitment openings are created by the given key
+// holder, which need not hold the directory's private key in this process.
+func NewDirectoryWithKeyHolder(kh KeyHolder, keys storage.KeyStore, nodes storage.NodeStore, log storage.LogStore, opts ...Option) (*Directory, error) {
+	d, err := newDirectory(keys, nodes, log, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	suite := kh.VerifyingKey().Suite()
+	if d.vrfSuite != 0 && d.vrfSuite != suite {
+		return nil, fmt.Errorf("akd: key holder has VRF suite %v, want %v", suite, d.vrfSuite)
+	}
+	d.vrfSuite = suite
+	d.kh = kh
+	d.vk = kh.VerifyingKey().Precompute()
+
+	return d, nil
+}
+
+func newDirectory(keys storage.KeyStore, nodes storage.NodeStore, log storage.LogStore, opts []Option) (*Directory, error) {
 	// Create a new prefix tree with the given storage.
 	tree := prefix.NewTree(sha256.Sum256, nodes)
 
-	// Derive a VRF proving key from the seed.
-	pk := vrf.NewProvingKey(privateKey)
+	d := &Directory{
+		keys:   keys,
+		log:    log,
+		tree:   tree,
+		tracer: otel.Tracer(tracerName),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
 
-	// Derive an HMAC commitment key from the seed.
-	ck, _ := hkdf.Expand(sha256.New, privateKey.Seed(), "keydonkey commitment key derivation", 32)
+	if _, ok := log.(storage.LogIntegrator); d.integrate && !ok {
+		return nil, errors.New("akd: log store does not support integration")
+	}
+	if _, ok := log.(storage.RootLogger); d.logRoots && !ok {
+		return nil, errors.New("akd: log store does not support root logging")
+	}
 
-	return &Directory{
-		pk:   pk,
-		ck:   ck,
-		keys: keys,
-		log:  log,
-		tree: tree,
-	}, nil
+	return d, nil
 }
 
+// VerifyingKey returns the key which verifies the directory's VRF proofs. As it is long-lived, it has a precomputed
+// table.
 func (d *Directory) VerifyingKey() *vrf.VerifyingKey {
-	return &d.pk.VerifyingKey
+	return d.vk
+}
+
+// ErrCheckpointUnsupported is returned by Checkpoint when the directory's log store cannot read checkpoints.
+var ErrCheckpointUnsupported = errors.New("akd: log store does not support reading checkpoints")
+
+// Checkpoint returns the latest signed checkpoint of the directory's transparency log.
+func (d *Directory) Checkpoint(ctx context.Context) (_ []byte, err error) {
+	ctx, span := d.tracer.Start(ctx, "log.LatestCheckpoint")
+	defer func() { endSpan(span, err) }()
+
+	reader, ok := d.log.(storage.CheckpointReader)
+	if !ok {
+		return nil, ErrCheckpointUnsupported
+	}
+	return reader.LatestCheckpoint(ctx)
 }
 
-func (d *Directory) Publish(ctx context.Context, id string, pk ed25519.PublicKey, version uint64) (*PublishResult, error) {
-	var label, commitment, opening [32]byte
+func (d *Directory) Publish(ctx context.Context, id string, pk ed25519.PublicKey, version uint64) (_ *PublishResult, err error) {
+	var label [32]byte
+
+	ctx, span := d.startSpan(ctx, "akd.Publish", version)
+	defer func() { endSpan(span, err) }()
 
 	// Generate a VRF proof and hash from the key ID and version.
-	vrfProof, vrfHash := d.pk.Prove(vrfInput(id, version))
+	vrfProof, vrfHash, err := d.prove(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
 
 	// Truncate the hash to 32 bytes to use as a prefix tree label.
 	copy(label[:], vrfHash[:32])
 
-	// Derive a commitment opening via HMAC(ck, label || version || pk).
-	h := hmac.New(sha256.New, d.ck)
-	h.Write(label[:])
-	_ = binary.Write(h, binary.BigEndian, version)
-	h.Write(pk)
-	h.Sum(opening[:0])
+	// Derive the commitment opening and the commitment.
+	opening, commitment, err := d.commit(ctx, label, version, pk)
+	if err != nil {
+		return nil, err
+	}
 
-	// Derive a commitment via HMAC(opening, pk).
-	h = hmac.New(sha256.New, opening[:])
-	h.Write(pk)
-	h.Sum(commitment[:0])
+	res, err := d.publish(ctx, id, pk, version, label, commitment)
+	if err != nil {
+		return nil, err
+	}
+	res.IndexProof, res.IndexOpening = vrfProof, opening[:]
+
+	// Wait for a checkpoint to cover the log entry, if required. The lock isn't held while waiting, so other operations
+	// can proceed until the checkpoint is published.
+	if d.integrate {
+		inclusion, err := d.waitForLog(ctx, res.LogIndex)
+		if err != nil {
+			return nil, err
+		}
+		res.Checkpoint, res.InclusionProof = inclusion.Checkpoint, inclusion.Proof
+	}
+	return res, nil
+}
+
+// publish inserts the given label and commitment into the prefix tree and the transparency log, logs the tree's new
+// root if required, and stores the key, returning a result with a membership proof but no index proof or checkpoint.
+// It holds d.mu, so that concurrent publishes neither lose each other's insertions nor interleave their log entries.
+func (d *Directory) publish(ctx context.Context, id string, pk ed25519.PublicKey, version uint64, label, commitment [32]byte) (*PublishResult, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
 	// Insert the label and the commitment into the prefix tree. Both are opaque values which do not reveal information
 	// about the key ID, the key version, or the key itself.
-	if err := d.tree.Insert(ctx, label, commitment); err != nil {
+	if err := d.insert(ctx, label, commitment); err != nil {
 		return nil, err
 	}
 
 	// Append the label and commitment to the transparency log.
-	if err := d.log.Add(ctx, label[:], commitment[:]); err != nil {
+	index, err := d.addToLog(ctx, label, commitment)
+	if err != nil {
 		return nil, err
 	}
 
+	// Start a new epoch by appending the tree's new root to the transparency log.
+	if d.logRoots {
+		if err := d.logRoot(ctx); err != nil {
+			return nil, err
+		}
+	}
+
 	// Insert the key into the shared database.
-	if err := d.keys.Put(ctx, id, pk, version); err != nil {
+	if err := d.putKey(ctx, id, pk, version); err != nil {
 		return nil, err
 	}
 
-	// Read the current root hash of the prefix tree. This may be a later root hash than the one in which the key was
-	// added, but it'll still work.
+	// Read the current root hash of the prefix tree, in which the key was added.
 	rootHash, err := d.tree.RootHash(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	// Look up the newly-inserted label to generate a membership proof.
-	found, membershipProof, err := d.tree.Lookup(ctx, label)
+	found, membershipProof, err := d.lookupLabel(ctx, label)
 	if err != nil {
 		return nil, err
 	}
@@ -97,19 +249,45 @@ func (d *Directory) Publish(ctx context.Context, id string, pk ed25519.PublicKey
 		panic("akd: could not lookup inserted label")
 	}
 
-	return &PublishResult{
+	res := &PublishResult{
 		ID:              id,
 		Version:         version,
 		PublicKey:       pk,
 		MembershipProof: membershipProof,
 		RootHash:        rootHash,
-		IndexProof:      vrfProof,
-		IndexOpening:    opening[:],
-	}, nil
+		LogIndex:        index,
+	}
+	res.Epoch, res.RootLogIndex = d.loggedRoot(rootHash)
+	return res, nil
 }
 
-func (d *Directory) Lookup(ctx context.Context, id string, minVersion uint64) (*LookupResult, error) {
-	var label, opening [32]byte
+func (d *Directory) Lookup(ctx context.Context, id string, minVersion uint64) (_ *LookupResult, err error) {
+	ctx, span := d.startSpan(ctx, "akd.Lookup", minVersion)
+	defer func() { endSpan(span, err) }()
+
+	if d.logRoots {
+		// The latest root entry must be loaded before the lock can be shared.
+		d.mu.Lock()
+		err := d.loadRoot(ctx)
+		d.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+	}
+
+	res, err := d.lookup(ctx, id, minVersion)
+	if err != nil {
+		return nil, err
+	}
+	res.Epoch, res.RootLogIndex = d.loggedRoot(res.RootHash)
+	return res, nil
+}
+
+func (d *Directory) lookup(ctx context.Context, id string, minVersion uint64) (*LookupResult, error) {
+	var label [32]byte
 
 	// Find the current root hash of the prefix tree. It's used for verifying both membership and non-membership proofs.
 	rootHash, err := d.tree.RootHash(ctx)
@@ -118,24 +296,37 @@ func (d *Directory) Lookup(ctx context.Context, id string, minVersion uint64) (*
 	}
 
 	// Lookup the key from the database by ID.
-	found, pk, version, err := d.keys.Get(ctx, id, minVersion)
+	found, pk, version, err := d.getKey(ctx, id, minVersion)
 	if err != nil {
 		return nil, err
 	}
 	if !found {
+		// If every stored version has been erased, the latest tombstone stands in for the key, even if it is older than
+		// minVersion, as version 0 may have been published and erased, so its label can't be proven absent.
+		tombstones, err := d.tombstones(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(tombstones); n > 0 {
+			return d.lookupErased(ctx, id, &tombstones[n-1], rootHash)
+		}
+
 		// Generate a VRF proof and hash from the non-existent key ID and a version of 0.
-		vrfProof, vrfHash := d.pk.Prove(vrfInput(id, 0))
+		vrfProof, vrfHash, err := d.prove(ctx, id, 0)
+		if err != nil {
+			return nil, err
+		}
 
 		// Truncate the VRF hash and use as the prefix tree label.
 		copy(label[:], vrfHash[:32])
 
 		// Look up the missing label in the prefix tree to generate a non-membership proof.
-		found, membershipProof, err := d.tree.Lookup(ctx, label)
+		found, membershipProof, err := d.lookupLabel(ctx, label)
 		if err != nil {
 			return nil, err
 		}
 		if found {
-			panic("akd: key found in tree but not database")
+			return nil, fmt.Errorf("akd: version 0 of %q found in tree but not database", id)
 		}
 
 		// Return all the information required to verify the non-membership proof.
@@ -151,14 +342,25 @@ func (d *Directory) Lookup(ctx context.Context, id string, minVersion uint64) (*
 		}, nil
 	}
 
+	return d.lookupVersion(ctx, id, pk, version, rootHash)
+}
+
+// lookupVersion returns the given stored version of a key, with a membership proof for it in the tree with the given
+// root hash.
+func (d *Directory) lookupVersion(ctx context.Context, id string, pk ed25519.PublicKey, version uint64, rootHash [32]byte) (*LookupResult, error) {
+	var label [32]byte
+
 	// Generate a VRF proof and hash from the key ID and version.
-	vrfProof, vrfHash := d.pk.Prove(vrfInput(id, version))
+	vrfProof, vrfHash, err := d.prove(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
 
 	// Truncate the VRF hash and use as the prefix tree label.
 	copy(label[:], vrfHash[:32])
 
 	// Lookup the label in the prefix tree and generate a membership proof.
-	found, membershipProof, err := d.tree.Lookup(ctx, label)
+	found, membershipProof, err := d.lookupLabel(ctx, label)
 	if err != nil {
 		return nil, err
 	}
@@ -166,12 +368,11 @@ func (d *Directory) Lookup(ctx context.Context, id string, minVersion uint64) (*
 		panic("akd: key found in database but not tree")
 	}
 
-	// Re-derive the commitment opening via HMAC(ck, label || version || pk).
-	h := hmac.New(sha256.New, d.ck)
-	h.Write(label[:])
-	_ = binary.Write(h, binary.BigEndian, version)
-	h.Write(pk)
-	h.Sum(opening[:0])
+	// Re-derive the commitment opening.
+	opening, _, err := d.commit(ctx, label, version, pk)
+	if err != nil {
+		return nil, err
+	}
 
 	// Return the key and all information required to verify the index proof and the membership proof.
 	return &LookupResult{
@@ -186,6 +387,256 @@ func (d *Directory) Lookup(ctx context.Context, id string, minVersion uint64) (*
 	}, nil
 }
 
+// ErrHistoryUnsupported is returned by History when the directory's key store cannot enumerate a key's versions.
+var ErrHistoryUnsupported = errors.New("akd: key store does not support history")
+
+// History returns a lookup result for every stored version of the given ID, in ascending order of version, each with a
+// membership proof in the same tree. Erased versions have results with Erased set. If the ID has no stored versions,
+// the result is empty.
+func (d *Directory) History(ctx context.Context, id string) (_ []*LookupResult, err error) {
+	ctx, span := d.startSpan(ctx, "akd.History", 0)
+	defer func() { endSpan(span, err) }()
+
+	lister, ok := d.keys.(storage.VersionLister)
+	if !ok {
+		return nil, ErrHistoryUnsupported
+	}
+
+	if d.logRoots {
+		// The latest root entry must be loaded before the lock can be shared.
+		d.mu.Lock()
+		err := d.loadRoot(ctx)
+		d.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+	}
+
+	rootHash, err := d.tree.RootHash(ctx)
+	if err != nil {
+		return nil, err
+	}
+	epoch, rootIndex := d.loggedRoot(rootHash)
+
+	// Erased versions are all older than the stored versions.
+	tombstones, err := d.tombstones(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := lister.Versions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*LookupResult, 0, len(tombstones)+len(versions))
+	for i := range tombstones {
+		res, err := d.lookupErased(ctx, id, &tombstones[i], rootHash)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Epoch, res.RootLogIndex = epoch, rootIndex
+		results = append(results, res)
+	}
+	for _, version := range versions {
+		found, pk, err := lister.GetVersion(ctx, id, version)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+
+		res, err := d.lookupVersion(ctx, id, pk, version, rootHash)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Epoch, res.RootLogIndex = epoch, rootIndex
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// ErrErasureUnsupported is returned by Erase when the directory's key store cannot enumerate or erase keys.
+var ErrErasureUnsupported = errors.New("akd: key store does not support erasure")
+
+// ErrNotFound is returned by Erase when the given ID has no stored versions.
+var ErrNotFound = errors.New("akd: key not found")
+
+// Erase removes the stored public keys for every version of the given ID. The opaque label and commitment leaves in
+// the prefix tree and the transparency log are left intact, so existing proofs remain valid and later lookups of an
+// erased version return a verifiable result with Erased set. The commitments are kept in tombstones stored under a
+// pseudonym which only the directory's key holder can derive from the ID.
+func (d *Directory) Erase(ctx context.Context, id string) (err error) {
+	ctx, span := d.startSpan(ctx, "akd.Erase", 0)
+	defer func() { endSpan(span, err) }()
+
+	lister, ok := d.keys.(storage.VersionLister)
+	if !ok {
+		return ErrErasureUnsupported
+	}
+	eraser, ok := d.keys.(storage.Eraser)
+	if !ok {
+		return ErrErasureUnsupported
+	}
+
+	// A concurrent publish of the ID must not store a version between the tombstones and the deletions.
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	versions, err := lister.Versions(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return ErrNotFound
+	}
+
+	pseudonym, err := d.pseudonym(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+		found, pk, err := lister.GetVersion(ctx, id, version)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+
+		// Re-derive the label and commitment for this version. The commitment is retained in the tombstone so that
+		// lookups can still prove the label's membership in the tree without the public key.
+		_, vrfHash, err := d.prove(ctx, id, version)
+		if err != nil {
+			return err
+		}
+		var label [32]byte
+		copy(label[:], vrfHash[:32])
+		_, commitment, err := d.commit(ctx, label, version, pk)
+		if err != nil {
+			return err
+		}
+
+		if err := eraser.Erase(ctx, id, version, pseudonym[:], commitment[:]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pseudonym returns the pseudonym under which the tombstones of the given ID are stored. The key holder derives it like
+// a commitment opening, but from a hash of the ID and no public key, so it can't be computed without the key holder.
+func (d *Directory) pseudonym(ctx context.Context, id string) ([32]byte, error) {
+	return d.kh.Opening(ctx, sha256.Sum256([]byte("keydonkey erasure pseudonym\x00"+id)), 0, nil)
+}
+
+func (d *Directory) lookupErased(ctx context.Context, id string, erased *storage.Tombstone, rootHash [32]byte) (*LookupResult, error) {
+	var label [32]byte
+
+	// Generate a VRF proof and hash from the key ID and the erased version.
+	vrfProof, vrfHash, err := d.prove(ctx, id, erased.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Truncate the VRF hash and use as the prefix tree label.
+	copy(label[:], vrfHash[:32])
+
+	// Lookup the label in the prefix tree and generate a membership proof for the retained commitment.
+	found, membershipProof, err := d.lookupLabel(ctx, label)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("akd: erased key version %d not found in tree", erased.Version)
+	}
+
+	return &LookupResult{
+		ID:              id,
+		Version:         erased.Version,
+		PublicKey:       nil,
+		MembershipProof: membershipProof,
+		RootHash:        rootHash,
+		Found:           true,
+		Erased:          true,
+		Commitment:      erased.Commitment,
+		IndexProof:      vrfProof,
+		IndexOpening:    nil,
+	}, nil
+}
+
+// loadRoot loads the latest root entry from the transparency log, if it has not already been loaded. The caller must
+// hold d.mu for writing.
+func (d *Directory) loadRoot(ctx context.Context) error {
+	if d.rootLoaded {
+		return nil
+	}
+
+	root, index, err := d.log.(storage.RootLogger).LatestRoot(ctx)
+	if err != nil {
+		return err
+	}
+
+	d.root, d.rootIndex, d.rootLoaded = root, index, true
+	return nil
+}
+
+// logRoot appends a root entry for the tree's current root to the transparency log, starting a new epoch. The caller
+// must hold d.mu for writing.
+func (d *Directory) logRoot(ctx context.Context) error {
+	if err := d.loadRoot(ctx); err != nil {
+		return err
+	}
+
+	rootHash, err := d.tree.RootHash(ctx)
+	if err != nil {
+		return err
+	}
+
+	root := storage.LogRoot{Epoch: 1, Time: time.Now(), Hash: rootHash}
+	if d.root != nil {
+		root.Epoch = d.root.Epoch + 1
+	}
+
+	index, err := d.addRootToLog(ctx, root)
+	if err != nil {
+		return err
+	}
+
+	d.root, d.rootIndex = &root, index
+	return nil
+}
+
+// loggedRoot returns the epoch and the index of the root entry of the latest logged root, if it has the given hash.
+// Otherwise, it returns zero. The caller must hold d.mu.
+func (d *Directory) loggedRoot(rootHash [32]byte) (epoch, index uint64) {
+	if d.root == nil || d.root.Hash != rootHash {
+		return 0, 0
+	}
+	return d.root.Epoch, d.rootIndex
+}
+
+// commit derives a commitment opening with the key holder and a commitment via HMAC(opening, pk).
+func (d *Directory) commit(ctx context.Context, label [32]byte, version uint64, pk ed25519.PublicKey) (opening, commitment [32]byte, err error) {
+	opening, err = d.kh.Opening(ctx, label, version, pk)
+	if err != nil {
+		return opening, commitment, err
+	}
+
+	h := hmac.New(sha256.New, opening[:])
+	h.Write(pk)
+	h.Sum(commitment[:0])
+
+	return opening, commitment, nil
+}
+
 type PublishResult struct {
 	ID              string
 	Version         uint64
@@ -194,9 +645,28 @@ type PublishResult struct {
 	RootHash        [32]byte
 	IndexProof      []byte
 	IndexOpening    []byte
+
+	// LogIndex is the index of the transparency log entry containing the label and commitment.
+	LogIndex uint64
+
+	// Checkpoint is the signed log checkpoint covering the entry, if the directory waited for integration.
+	Checkpoint []byte
+
+	// InclusionProof is the Merkle inclusion proof of the entry in the checkpoint's tree.
+	InclusionProof [][]byte
+
+	// Epoch is the epoch of RootHash, if the directory logs roots and RootHash has been logged. Otherwise, it is zero.
+	Epoch uint64
+
+	// RootLogIndex is the index of the transparency log entry recording RootHash, if Epoch is non-zero.
+	RootLogIndex uint64
 }
 
-func (r *PublishResult) Verify(vk *vrf.VerifyingKey) bool {
+// Verify returns true if the result's proofs are valid. If any verifiers are given, the result must include a
+// checkpoint. The log's verifier must be given first, and the checkpoint must be signed by it and include the label and
+// commitment at LogIndex. The checkpoint must also be cosigned by each of the other given verifiers, such as those
+// returned by storage.NewWitnessVerifier.
+func (r *PublishResult) Verify(vk *vrf.VerifyingKey, verifiers ...note.Verifier) bool {
 	var label, commitment [32]byte
 
 	// Verify the index proof and calculate the VRF proof hash.
@@ -217,6 +687,24 @@ func (r *PublishResult) Verify(vk *vrf.VerifyingKey) bool {
 	if err := prefix.VerifyMembershipProof(sha256.Sum256, label, commitment, r.MembershipProof, r.RootHash); err != nil {
 		return false
 	}
+
+	// A result without a checkpoint can't satisfy verifiers which expect its entry to be logged.
+	if r.Checkpoint == nil {
+		return len(verifiers) == 0
+	}
+
+	// Verify the checkpoint's signatures and the inclusion proof of the log entry.
+	if len(verifiers) == 0 {
+		return false
+	}
+	cp, err := storage.VerifyCheckpoint(r.Checkpoint, verifiers[0], len(verifiers)-1, verifiers[1:]...)
+	if err != nil {
+		return false
+	}
+	leafHash := rfc6962.DefaultHasher.HashLeaf(slices.Concat(label[:], commitment[:]))
+	if err := proof.VerifyInclusion(rfc6962.DefaultHasher, r.LogIndex, cp.Size, leafHash, r.InclusionProof, cp.Hash); err != nil {
+		return false
+	}
 	return true
 }
 
@@ -227,13 +715,30 @@ type LookupResult struct {
 	MembershipProof []prefix.ProofNode
 	RootHash        [32]byte
 	Found           bool
+	Erased          bool
+	Commitment      []byte
 	IndexProof      []byte
 	IndexOpening    []byte
+
+	// Epoch is the epoch of RootHash, if the directory logs roots and RootHash has been logged. Otherwise, it is zero.
+	Epoch uint64
+
+	// RootLogIndex is the index of the transparency log entry recording RootHash, if Epoch is non-zero.
+	RootLogIndex uint64
 }
 
-func (r *LookupResult) Verify(vk *vrf.VerifyingKey) bool {
+// Verify returns true if the result's proofs are valid. If logged is non-nil, it must be the root entry at
+// RootLogIndex, as read from the transparency log and verified against a checkpoint, such as with
+// logreader.Reader.Entry; the result must then have a non-zero Epoch, and the entry must record its epoch and root
+// hash.
+func (r *LookupResult) Verify(vk *vrf.VerifyingKey, logged *storage.LogRoot) bool {
 	var label, commitment [32]byte
 
+	// Check that the root hash was logged as the root of the result's epoch.
+	if logged != nil && (r.Epoch == 0 || logged.Epoch != r.Epoch || logged.Hash != r.RootHash) {
+		return false
+	}
+
 	// Verify the index proof and calculate the VRF proof hash.
 	vrfHash, err := vk.Verify(vrfInput(r.ID, r.Version), r.IndexProof)
 	if err != nil {
@@ -251,10 +756,18 @@ func (r *LookupResult) Verify(vk *vrf.VerifyingKey) bool {
 		return true
 	}
 
-	// Re-derive the index commitment for the public key using the given opening.
-	h := hmac.New(sha256.New, r.IndexOpening[:])
-	h.Write(r.PublicKey)
-	h.Sum(commitment[:0])
+	if r.Erased {
+		// If the key was erased, only the opaque commitment remains to be verified.
+		if len(r.Commitment) != len(commitment) {
+			return false
+		}
+		copy(commitment[:], r.Commitment)
+	} else {
+		// Re-derive the index commitment for the public key using the given opening.
+		h := hmac.New(sha256.New, r.IndexOpening[:])
+		h.Write(r.PublicKey)
+		h.Sum(commitment[:0])
+	}
 
 	// Verify the membership proof of the commitment.
 	if err := prefix.VerifyMembershipProof(sha256.Sum256, label, commitment, r.MembershipProof, r.RootHash); err != nil {
@@ -263,6 +776,26 @@ func (r *LookupResult) Verify(vk *vrf.VerifyingKey) bool {
 	return true
 }
 
+// VerifyHistory returns true if the given results of History are valid. They must be in ascending order of version,
+// have membership proofs in the same tree, and each verify as by LookupResult.Verify with the given logged root. As a
+// history may have many results, a precomputed table is used to verify them.
+func VerifyHistory(vk *vrf.VerifyingKey, results []*LookupResult, logged *storage.LogRoot) bool {
+	vk = vk.Precompute()
+	for i, res := range results {
+		if i > 0 {
+			prev := results[i-1]
+			if res.ID != prev.ID || res.Version <= prev.Version || res.RootHash != prev.RootHash ||
+				res.Epoch != prev.Epoch || res.RootLogIndex != prev.RootLogIndex {
+				return false
+			}
+		}
+		if !res.Found || !res.Verify(vk, logged) {
+			return false
+		}
+	}
+	return true
+}
+
 func vrfInput(id string, version uint64) ed25519.PublicKey {
 	input := make([]byte, len(id)+8)
 	copy(input, id)
@@ -1,18 +1,29 @@
 package akd
 
 import (
+	"bytes"
+	"context"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"iter"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
 	"filippo.io/torchwood/prefix"
+	"github.com/codahale/keydonkey/internal/logreader"
 	"github.com/codahale/keydonkey/internal/storage"
+	"github.com/transparency-dev/formats/log"
+	fnote "github.com/transparency-dev/formats/note"
 	"github.com/transparency-dev/tessera"
 	"github.com/transparency-dev/tessera/storage/posix"
+	"golang.org/x/mod/sumdb/note"
 )
 
 func TestRoundTrip(t *testing.T) {
@@ -73,7 +84,7 @@ func TestRoundTrip(t *testing.T) {
 		}
 	})
 
-	log := storage.NewTesseraLog(appender)
+	log := storage.NewTesseraLog(appender, reader, nil)
 
 	akd, err := NewDirectory(privateKey, keys, nodes, log)
 	if err != nil {
@@ -85,7 +96,7 @@ func TestRoundTrip(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if !missing.Verify(akd.VerifyingKey()) {
+	if !missing.Verify(akd.VerifyingKey(), nil) {
 		t.Error("did not verify")
 	}
 
@@ -106,6 +117,10 @@ func TestRoundTrip(t *testing.T) {
 		t.Error("did not verify")
 	}
 
+	if got, want := publishRes.LogIndex, uint64(0); got != want {
+		t.Errorf("LogIndex = %v, want %v", got, want)
+	}
+
 	entries, err = reader.NextIndex(t.Context())
 	if err != nil {
 		t.Fatal(err)
@@ -114,12 +129,410 @@ func TestRoundTrip(t *testing.T) {
 		t.Errorf("entries = %v, want %v", got, want)
 	}
 
+	versions, err := keys.Versions(t.Context(), "dingus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := versions, []uint64{22}; !slices.Equal(got, want) {
+		t.Errorf("versions = %v, want %v", got, want)
+	}
+
 	lookupRes, err := akd.Lookup(t.Context(), "dingus", 20)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if !lookupRes.Verify(akd.VerifyingKey()) {
+	if !lookupRes.Verify(akd.VerifyingKey(), nil) {
 		t.Error("did not verify")
 	}
+
+	if _, err := akd.Publish(t.Context(), "dingus", pubKey, 23); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := akd.History(t.Context(), "dingus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(history), 2; got != want {
+		t.Fatalf("len(history) = %d, want %d", got, want)
+	}
+	for i, res := range history {
+		if got, want := res.Version, uint64(22+i); got != want {
+			t.Errorf("history[%d].Version = %d, want %d", i, got, want)
+		}
+		if res.RootHash != history[0].RootHash {
+			t.Errorf("history[%d] has a different root hash", i)
+		}
+		if !res.Verify(akd.VerifyingKey(), nil) {
+			t.Errorf("history[%d] did not verify", i)
+		}
+	}
+	if !VerifyHistory(akd.VerifyingKey(), history, nil) {
+		t.Error("history did not verify")
+	}
+	if VerifyHistory(akd.VerifyingKey(), []*LookupResult{history[1], history[0]}, nil) {
+		t.Error("verified a history out of order")
+	}
+
+	if err := akd.Erase(t.Context(), "dingus"); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err = akd.History(t.Context(), "dingus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(history), 2; got != want {
+		t.Fatalf("len(history) = %d, want %d", got, want)
+	}
+	for i, res := range history {
+		if res.Version != uint64(22+i) || !res.Erased || !res.Verify(akd.VerifyingKey(), nil) {
+			t.Errorf("history[%d] = version %d, erased %v, want a verifiable erased result for version %d", i,
+				res.Version, res.Erased, 22+i)
+		}
+	}
+	if !VerifyHistory(akd.VerifyingKey(), history, nil) {
+		t.Error("erased history did not verify")
+	}
+
+	// Nothing derived from the ID alone is left in the key store.
+	idHash := sha256.Sum256([]byte("dingus"))
+	if matches, err := fs.Glob(root.FS(), "keys/*/*/"+hex.EncodeToString(idHash[:])+"*"); err != nil || len(matches) != 0 {
+		t.Errorf("key files = %v, %v, want none", matches, err)
+	}
+
+	for _, id := range []string{"dingus", "missing"} {
+		if err := akd.Erase(t.Context(), id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Erase(%q) = %v, want ErrNotFound", id, err)
+		}
+	}
+
+	if history, err := akd.History(t.Context(), "missing"); err != nil || len(history) != 0 {
+		t.Errorf("History() = %v, %v, want no results", history, err)
+	}
+
+	erasedRes, err := akd.Lookup(t.Context(), "dingus", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !erasedRes.Erased || erasedRes.PublicKey != nil {
+		t.Errorf("erased = %v, public key = %x, want erased without public key", erasedRes.Erased, erasedRes.PublicKey)
+	}
+
+	if !erasedRes.Verify(akd.VerifyingKey(), nil) {
+		t.Error("did not verify")
+	}
+
+	// A key whose only version was version 0 can't be proven absent once it has been erased, so its tombstone is
+	// returned even for later minimum versions.
+	if _, err := akd.Publish(t.Context(), "zero", pubKey, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := akd.Erase(t.Context(), "zero"); err != nil {
+		t.Fatal(err)
+	}
+	zeroRes, err := akd.Lookup(t.Context(), "zero", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !zeroRes.Erased || zeroRes.Version != 0 || !zeroRes.Verify(akd.VerifyingKey(), nil) {
+		t.Errorf("Lookup() = version %d, erased %v, want a verifiable erased result for version 0", zeroRes.Version,
+			zeroRes.Erased)
+	}
+}
+
+func TestPublishIntegration(t *testing.T) {
+	pubKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := prefix.NewMemoryStorage()
+	if err := prefix.InitStorage(t.Context(), sha256.Sum256, nodes); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := storage.NewFSKeyStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := keys.Close(); err != nil {
+			t.Log(err)
+		}
+	})
+
+	skey, vkey, err := note.GenerateKey(rand.Reader, "KeyDonkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	witnessSKey, witnessVKey, err := note.GenerateKey(rand.Reader, "Witness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	witnessSigner, err := fnote.NewSignerForCosignatureV1(witnessSKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	witnessVerifier, err := storage.NewWitnessVerifier(witnessVKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	driver, err := posix.New(t.Context(), posix.Config{Path: filepath.Join(dir, "log")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appender, shutdown, reader, err := tessera.NewAppender(t.Context(), driver, tessera.NewAppendOptions().
+		WithCheckpointSigner(signer).
+		WithCheckpointInterval(100*time.Millisecond).
+		WithBatching(10, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := shutdown(t.Context()); err != nil {
+			t.Log(err)
+		}
+	})
+
+	log := storage.NewIntegratingTesseraLog(t.Context(), appender, reader, nil, 10*time.Millisecond)
+
+	if _, err := NewDirectory(privateKey, keys, nodes, storage.NewTesseraLog(appender, reader, nil), WithLogIntegration()); err == nil {
+		t.Error("created directory with a log which does not support integration")
+	}
+
+	akd, err := NewDirectory(privateKey, keys, nodes, log, WithLogIntegration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, id := range []string{"dingus", "dongus", "dangus"} {
+		res, err := akd.Publish(t.Context(), id, pubKey, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := res.LogIndex, uint64(i); got != want {
+			t.Errorf("LogIndex = %v, want %v", got, want)
+		}
+
+		if res.Checkpoint == nil {
+			t.Fatal("no checkpoint")
+		}
+
+		if !res.Verify(akd.VerifyingKey(), verifier) {
+			t.Error("did not verify")
+		}
+
+		if res.Verify(akd.VerifyingKey()) {
+			t.Error("verified checkpoint without log verifier")
+		}
+
+		// A checkpoint must be cosigned by every witness the client requires.
+		if res.Verify(akd.VerifyingKey(), verifier, witnessVerifier) {
+			t.Error("verified checkpoint without witness cosignature")
+		}
+		n, err := note.Open(res.Checkpoint, note.VerifierList(verifier))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cosigned, err := note.Sign(&note.Note{Text: n.Text}, witnessSigner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, cosignature, _ := bytes.Cut(cosigned, []byte("\n\n"))
+		res.Checkpoint = append(res.Checkpoint, cosignature...)
+		if !res.Verify(akd.VerifyingKey(), verifier, witnessVerifier) {
+			t.Error("did not verify with witness cosignature")
+		}
+
+		res.LogIndex++
+		if res.Verify(akd.VerifyingKey(), verifier) {
+			t.Error("verified inclusion proof with wrong index")
+		}
+		res.LogIndex--
+
+		// A result stripped of its checkpoint doesn't verify against the log.
+		res.Checkpoint = nil
+		if res.Verify(akd.VerifyingKey(), verifier) {
+			t.Error("verified result without checkpoint against log verifier")
+		}
+		if !res.Verify(akd.VerifyingKey()) {
+			t.Error("did not verify without checkpoint")
+		}
+	}
+}
+
+func TestRootLogging(t *testing.T) {
+	pubKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := prefix.NewMemoryStorage()
+	if err := prefix.InitStorage(t.Context(), sha256.Sum256, nodes); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := storage.NewFSKeyStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := keys.Close(); err != nil {
+			t.Log(err)
+		}
+	})
+
+	skey, vkey, err := note.GenerateKey(rand.Reader, "KeyDonkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logDir := filepath.Join(dir, "log")
+	driver, err := posix.New(t.Context(), posix.Config{Path: logDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appender, shutdown, reader, err := tessera.NewAppender(t.Context(), driver, tessera.NewAppendOptions().
+		WithCheckpointSigner(signer).
+		WithCheckpointInterval(100*time.Millisecond).
+		WithBatching(10, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := shutdown(t.Context()); err != nil {
+			t.Log(err)
+		}
+	})
+
+	if _, err := NewDirectory(privateKey, keys, nodes, nopLog{}, WithRootLogging()); err == nil {
+		t.Error("created directory with a log which does not support root logging")
+	}
+
+	for _, id := range []string{"dingus", "dongus", "dangus"} {
+		// Each publish uses a new directory, which must recover the latest epoch from the log.
+		akd, err := NewDirectory(privateKey, keys, nodes, storage.NewTesseraLog(appender, reader, root), WithRootLogging())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := akd.Publish(t.Context(), id, pubKey, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	akd, err := NewDirectory(privateKey, keys, nodes, storage.NewTesseraLog(appender, reader, root), WithRootLogging())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lookupRes, err := akd.Lookup(t.Context(), "dongus", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lookupRes.Epoch, uint64(3); got != want {
+		t.Errorf("Epoch = %d, want %d", got, want)
+	}
+	if got, want := lookupRes.RootLogIndex, uint64(5); got != want {
+		t.Errorf("RootLogIndex = %d, want %d", got, want)
+	}
+
+	// Check that the served root was logged.
+	r := logreader.NewReader(logreader.NewFileFetcher(logDir), verifier)
+	cp := waitForCheckpoint(t, r, 6)
+	entry, err := r.Entry(t.Context(), cp, lookupRes.RootLogIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Type != logreader.RootEntry || !lookupRes.Verify(akd.VerifyingKey(), &entry.Root) {
+		t.Errorf("logged root = %+v, want epoch %d and hash %x", entry.Root, lookupRes.Epoch, lookupRes.RootHash)
+	}
+
+	// A root logged for another epoch does not verify.
+	other, err := r.Entry(t.Context(), cp, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Type != logreader.RootEntry || lookupRes.Verify(akd.VerifyingKey(), &other.Root) {
+		t.Errorf("verified with the root of epoch %d", other.Root.Epoch)
+	}
+
+	// Replay the log to recompute every logged root.
+	stats, err := logreader.Replay(t.Context(), r.Entries(t.Context(), cp, 0), prefix.NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stats, (logreader.ReplayStats{Keys: 3, Roots: 3}); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+
+	// A log whose roots diverge from its entries must fail the replay.
+	tampered := func(yield func(logreader.Entry, error) bool) {
+		for e, err := range r.Entries(t.Context(), cp, 0) {
+			if e.Type == logreader.RootEntry && e.Root.Epoch == 2 {
+				e.Root.Hash[0] ^= 1
+			}
+			if !yield(e, err) {
+				return
+			}
+		}
+	}
+	if _, err := logreader.Replay(t.Context(), iter.Seq2[logreader.Entry, error](tampered), prefix.NewMemoryStorage()); !errors.Is(err, logreader.ErrRootMismatch) {
+		t.Errorf("Replay error = %v, want %v", err, logreader.ErrRootMismatch)
+	}
+}
+
+// waitForCheckpoint waits for the log to publish a checkpoint of at least the given size.
+func waitForCheckpoint(t *testing.T, r *logreader.Reader, size uint64) *log.Checkpoint {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+
+	for {
+		cp, err := r.Checkpoint(ctx)
+		if err == nil && cp.Size >= size {
+			return cp
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("no checkpoint of size %d: %v", size, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
 }
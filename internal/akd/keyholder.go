@@ -0,0 +1,79 @@
+package akd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/codahale/keydonkey/internal/vrf"
+)
+
+// Prover creates the VRF proofs which map key IDs and versions to prefix tree labels.
+type Prover interface {
+	// VerifyingKey returns the key which verifies the prover's proofs.
+	VerifyingKey() *vrf.VerifyingKey
+
+	// Prove returns a proof of the given input and the proof's hash.
+	Prove(ctx context.Context, alpha []byte) (proof, hash []byte, err error)
+}
+
+// Committer derives the openings of the commitments to published public keys.
+type Committer interface {
+	// Opening returns the commitment opening for the given label, key version, and public key.
+	Opening(ctx context.Context, label [32]byte, version uint64, pk ed25519.PublicKey) (opening [32]byte, err error)
+}
+
+// KeyHolder holds a directory's secret keys, creating its VRF proofs and commitment openings. Implementations may hold
+// the keys in another process, so that the directory's private key is never loaded into the directory's process.
+type KeyHolder interface {
+	Prover
+	Committer
+}
+
+// NewKeyHolder returns a KeyHolder which derives a VRF proving key with the given suite and an HMAC commitment key from
+// the given private key.
+func NewKeyHolder(privateKey ed25519.PrivateKey, suite vrf.Suite) (KeyHolder, error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("akd: invalid private key")
+	}
+	if suite != vrf.TAI && suite != vrf.ELL2 {
+		return nil, fmt.Errorf("akd: unknown VRF suite %v", suite)
+	}
+
+	// Derive an HMAC commitment key from the seed.
+	ck, _ := hkdf.Expand(sha256.New, privateKey.Seed(), "keydonkey commitment key derivation", 32)
+
+	// Derive a VRF proving key from the seed.
+	pk := vrf.NewProvingKey(privateKey, vrf.WithSuite(suite))
+
+	return &localKeyHolder{pk: pk, ck: ck}, nil
+}
+
+type localKeyHolder struct {
+	pk *vrf.ProvingKey
+	ck []byte
+}
+
+func (kh *localKeyHolder) VerifyingKey() *vrf.VerifyingKey {
+	return &kh.pk.VerifyingKey
+}
+
+func (kh *localKeyHolder) Prove(_ context.Context, alpha []byte) (proof, hash []byte, err error) {
+	proof, hash = kh.pk.Prove(alpha)
+	return proof, hash, nil
+}
+
+// Opening derives a commitment opening via HMAC(ck, label || version || pk).
+func (kh *localKeyHolder) Opening(_ context.Context, label [32]byte, version uint64, pk ed25519.PublicKey) (opening [32]byte, err error) {
+	h := hmac.New(sha256.New, kh.ck)
+	h.Write(label[:])
+	_ = binary.Write(h, binary.BigEndian, version)
+	h.Write(pk)
+	h.Sum(opening[:0])
+	return opening, nil
+}
@@ -0,0 +1,410 @@
+package akd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"filippo.io/torchwood/prefix"
+	"github.com/codahale/keydonkey/internal/storage"
+	"github.com/codahale/keydonkey/internal/vrf"
+	"github.com/transparency-dev/tessera"
+	"github.com/transparency-dev/tessera/storage/posix"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultOrigin is the origin of a transparency log opened with Open, unless another is given.
+const DefaultOrigin = "KeyDonkey"
+
+// DefaultPollPeriod is the period at which a directory opened with Open polls its transparency log, unless another is
+// given.
+const DefaultPollPeriod = 100 * time.Millisecond
+
+// ErrManifestMismatch is returned by Open when an existing directory was created with a different key or parameters.
+var ErrManifestMismatch = errors.New("akd: directory does not match manifest")
+
+// Options configures a directory opened with Open.
+type Options struct {
+	// PrivateKey is the directory's private key, from which its VRF key and commitment key are derived, and which signs
+	// the transparency log's checkpoints unless LogPrivateKey is given. It must not change for the life of the
+	// directory. Exactly one of PrivateKey and KeyHolder must be given.
+	PrivateKey ed25519.PrivateKey
+
+	// KeyHolder creates the directory's VRF proofs and commitment openings in place of PrivateKey, so that the
+	// directory's private key need not be loaded into this process. If VRFSuite is zero, the key holder's suite is
+	// used; otherwise, they must match. LogPrivateKey must be given with it.
+	KeyHolder KeyHolder
+
+	// LogPrivateKey is the private key which signs the transparency log's checkpoints. If nil, PrivateKey is used. It
+	// must not change for the life of the directory.
+	LogPrivateKey ed25519.PrivateKey
+
+	// Origin is the origin of the transparency log, which names the key its checkpoints are signed with. If empty,
+	// DefaultOrigin is used. It must not change for the life of the directory.
+	Origin string
+
+	// VRFSuite is the cipher suite of the directory's VRF proofs. If zero, vrf.ELL2 is used. It must not change for the
+	// life of the directory.
+	VRFSuite vrf.Suite
+
+	// PackNodes stores the prefix tree in a storage.PackNodeStore rather than a storage.FSNodeStore. It must not
+	// change for the life of the directory.
+	PackNodes bool
+
+	// RootLogging enables WithRootLogging. It must not change for the life of the directory.
+	RootLogging bool
+
+	// LogIntegration enables WithLogIntegration.
+	LogIntegration bool
+
+	// Antispam deduplicates the transparency log's entries with a storage.FSAntispam.
+	Antispam bool
+
+	// Witnesses are the witnesses which cosign the transparency log's checkpoints. If any are given, at least
+	// WitnessThreshold of them must cosign a checkpoint before it is published.
+	Witnesses        []storage.Witness
+	WitnessThreshold int
+
+	// CheckpointInterval and BatchMaxAge configure the tessera appender. If zero, tessera's defaults are used.
+	CheckpointInterval time.Duration
+	BatchMaxAge        time.Duration
+
+	// PollPeriod is the period at which the transparency log is polled for new checkpoints and entries. If zero,
+	// DefaultPollPeriod is used.
+	PollPeriod time.Duration
+
+	// TracerProvider records spans for the directory's operations. If nil, the global TracerProvider is used.
+	TracerProvider trace.TracerProvider
+}
+
+// manifest records the parameters of a directory created by Open, so that it is not reopened with different ones.
+type manifest struct {
+	Version     int
+	Origin      string
+	LogKey      string
+	VRFKey      []byte
+	VRFSuite    string
+	Nodes       string
+	RootLogging bool
+}
+
+const (
+	manifestFilename     = "manifest.json"
+	manifestTempFilename = manifestFilename + ".tmp"
+	manifestVersion      = 1
+)
+
+// Open creates a directory in the given filesystem directory, or reopens one previously created by Open, storing its
+// keys, prefix tree, and transparency log in subdirectories. When a directory is created, its parameters are recorded
+// in a manifest; reopening it with a different private key or parameters returns ErrManifestMismatch. The returned
+// function shuts down the transparency log and closes the directory's storage.
+func Open(ctx context.Context, dir string, opts Options) (_ *Directory, shutdown func(context.Context) error, err error) {
+	if opts.Origin == "" {
+		opts.Origin = DefaultOrigin
+	}
+	if opts.PollPeriod == 0 {
+		opts.PollPeriod = DefaultPollPeriod
+	}
+	if opts.KeyHolder != nil {
+		if opts.PrivateKey != nil {
+			return nil, nil, errors.New("akd: only one of a private key and a key holder may be given")
+		}
+		if opts.LogPrivateKey == nil {
+			return nil, nil, errors.New("akd: a key holder requires a log private key")
+		}
+		if opts.VRFSuite == 0 {
+			opts.VRFSuite = opts.KeyHolder.VerifyingKey().Suite()
+		}
+	}
+	if opts.LogPrivateKey == nil {
+		opts.LogPrivateKey = opts.PrivateKey
+	}
+	if opts.VRFSuite == 0 {
+		opts.VRFSuite = vrf.ELL2
+	}
+
+	want, err := newManifest(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, nil, err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Resources are closed in the reverse order they were opened in if opening fails.
+	closers := []func(context.Context) error{func(context.Context) error { return root.Close() }}
+	closeAll := func(ctx context.Context) error {
+		var errs []error
+		for _, c := range slices.Backward(closers) {
+			errs = append(errs, c(ctx))
+		}
+		return errors.Join(errs...)
+	}
+	defer func() {
+		if err != nil {
+			_ = closeAll(ctx)
+		}
+	}()
+
+	if err := checkManifest(root, want); err != nil {
+		return nil, nil, err
+	}
+
+	keys, err := storage.NewFSKeyStore(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	closers = append(closers, func(context.Context) error { return keys.Close() })
+
+	var nodes interface {
+		storage.NodeStore
+		Close() error
+	}
+	if opts.PackNodes {
+		nodes, err = storage.NewPackNodeStore(root)
+	} else {
+		nodes, err = storage.NewFSNodeStore(root)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	closers = append(closers, func(context.Context) error { return nodes.Close() })
+
+	// The tree is initialized when the directory is created, or if creation was interrupted before it was.
+	if _, err := nodes.Load(ctx, prefix.RootLabel); errors.Is(err, prefix.ErrNodeNotFound) {
+		if err := prefix.InitStorage(ctx, sha256.Sum256, nodes); err != nil {
+			return nil, nil, err
+		}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	log, logShutdown, err := openLog(ctx, root, dir, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	closers = append(closers, logShutdown)
+
+	dirOpts := []Option{WithVRFSuite(opts.VRFSuite)}
+	if opts.LogIntegration {
+		dirOpts = append(dirOpts, WithLogIntegration())
+	}
+	if opts.RootLogging {
+		dirOpts = append(dirOpts, WithRootLogging())
+	}
+	if opts.TracerProvider != nil {
+		dirOpts = append(dirOpts, WithTracerProvider(opts.TracerProvider))
+	}
+
+	var d *Directory
+	if opts.KeyHolder != nil {
+		d, err = NewDirectoryWithKeyHolder(opts.KeyHolder, keys, nodes, log, dirOpts...)
+	} else {
+		d, err = NewDirectory(opts.PrivateKey, keys, nodes, log, dirOpts...)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return d, closeAll, nil
+}
+
+// openLog opens the directory's tessera log. Its background tasks run until the returned function shuts it down.
+func openLog(ctx context.Context, root *os.Root, dir string, opts Options) (_ storage.LogStore, shutdown func(context.Context) error, err error) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	var as *storage.FSAntispam
+	stop := func() error {
+		cancel()
+		if as != nil {
+			return as.Close()
+		}
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			_ = stop()
+		}
+	}()
+
+	signer, err := storage.NewSigner(opts.Origin, opts.LogPrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	appendOpts := tessera.NewAppendOptions().WithCheckpointSigner(signer)
+	if opts.CheckpointInterval != 0 {
+		appendOpts.WithCheckpointInterval(opts.CheckpointInterval)
+	}
+	if opts.BatchMaxAge != 0 {
+		appendOpts.WithBatching(tessera.DefaultBatchMaxSize, opts.BatchMaxAge)
+	}
+	if len(opts.Witnesses) > 0 {
+		group, err := storage.NewWitnessGroup(opts.WitnessThreshold, opts.Witnesses...)
+		if err != nil {
+			return nil, nil, err
+		}
+		appendOpts.WithWitnesses(group, nil)
+	}
+	if opts.Antispam {
+		as, err = storage.NewFSAntispam(root, opts.PollPeriod)
+		if err != nil {
+			return nil, nil, err
+		}
+		appendOpts.WithAntispam(tessera.DefaultAntispamInMemorySize, as)
+	}
+
+	driver, err := posix.New(ctx, posix.Config{Path: filepath.Join(dir, "log")})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	appender, appenderShutdown, reader, err := tessera.NewAppender(ctx, driver, appendOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The appender is shut down before its background tasks are stopped and the antispam index is closed.
+	shutdown = func(ctx context.Context) error {
+		return errors.Join(appenderShutdown(ctx), stop())
+	}
+
+	if opts.LogIntegration {
+		return storage.NewIntegratingTesseraLog(ctx, appender, reader, root, opts.PollPeriod), shutdown, nil
+	}
+	return storage.NewTesseraLog(appender, reader, root), shutdown, nil
+}
+
+// newManifest returns the manifest of a directory opened with the given options.
+func newManifest(opts Options) (*manifest, error) {
+	if len(opts.LogPrivateKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("akd: invalid log private key")
+	}
+
+	logKey, err := storage.EncodeVerifierKey(opts.Origin, opts.LogPrivateKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	var vk *vrf.VerifyingKey
+	if opts.KeyHolder != nil {
+		vk = opts.KeyHolder.VerifyingKey()
+		if vk.Suite() != opts.VRFSuite {
+			return nil, fmt.Errorf("akd: key holder has VRF suite %v, want %v", vk.Suite(), opts.VRFSuite)
+		}
+	} else {
+		if len(opts.PrivateKey) != ed25519.PrivateKeySize {
+			return nil, errors.New("akd: invalid private key")
+		}
+
+		vk, err = vrf.NewVerifyingKey(opts.PrivateKey.Public().(ed25519.PublicKey), vrf.WithSuite(opts.VRFSuite))
+		if err != nil {
+			return nil, err
+		}
+	}
+	vrfKey, err := vk.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := "fs"
+	if opts.PackNodes {
+		nodes = "pack"
+	}
+
+	return &manifest{
+		Version:     manifestVersion,
+		Origin:      opts.Origin,
+		LogKey:      logKey,
+		VRFKey:      vrfKey,
+		VRFSuite:    vk.Suite().String(),
+		Nodes:       nodes,
+		RootLogging: opts.RootLogging,
+	}, nil
+}
+
+// checkManifest compares the manifest of the directory in the given root with the wanted manifest. If the directory is
+// empty, the wanted manifest is written to it. The manifest is written before anything else, so that a directory whose
+// creation was interrupted is still checked when it is reopened.
+func checkManifest(root *os.Root, want *manifest) error {
+	b, err := root.ReadFile(manifestFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		entries, err := fs.ReadDir(root.FS(), ".")
+		if err != nil {
+			return err
+		}
+		// A temporary manifest left by an interrupted creation is overwritten.
+		entries = slices.DeleteFunc(entries, func(e fs.DirEntry) bool { return e.Name() == manifestTempFilename })
+		if len(entries) > 0 {
+			return fmt.Errorf("akd: %s is not empty and has no %s", root.Name(), manifestFilename)
+		}
+		return writeManifest(root, want)
+	}
+	if err != nil {
+		return err
+	}
+
+	var got manifest
+	if err := json.Unmarshal(b, &got); err != nil {
+		return fmt.Errorf("akd: malformed %s: %w", manifestFilename, err)
+	}
+
+	switch {
+	case got.Version != want.Version:
+		return fmt.Errorf("%w: unsupported manifest version %d", ErrManifestMismatch, got.Version)
+	case got.Origin != want.Origin:
+		return fmt.Errorf("%w: origin is %q, not %q", ErrManifestMismatch, got.Origin, want.Origin)
+	case !slices.Equal(got.VRFKey, want.VRFKey):
+		return fmt.Errorf("%w: directory was created with a different private key", ErrManifestMismatch)
+	case got.LogKey != want.LogKey:
+		return fmt.Errorf("%w: log was created with a different private key", ErrManifestMismatch)
+	case got.VRFSuite == "":
+		return fmt.Errorf("%w: VRF suite is not recorded", ErrManifestMismatch)
+	case got.VRFSuite != want.VRFSuite:
+		return fmt.Errorf("%w: VRF suite is %s, not %s", ErrManifestMismatch, got.VRFSuite, want.VRFSuite)
+	case got.Nodes != want.Nodes:
+		return fmt.Errorf("%w: node store is %q, not %q", ErrManifestMismatch, got.Nodes, want.Nodes)
+	case got.RootLogging != want.RootLogging:
+		return fmt.Errorf("%w: root logging is %t, not %t", ErrManifestMismatch, got.RootLogging, want.RootLogging)
+	}
+
+	return nil
+}
+
+// writeManifest atomically writes the given manifest.
+func writeManifest(root *os.Root, m *manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := root.OpenFile(manifestTempFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return root.Rename(manifestTempFilename, manifestFilename)
+}
@@ -0,0 +1,205 @@
+package akd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codahale/keydonkey/internal/storage"
+	"github.com/codahale/keydonkey/internal/vrf"
+)
+
+func TestOpen(t *testing.T) {
+	pubKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := storage.NewVerifier(DefaultOrigin, privateKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "directory")
+	opts := Options{
+		PrivateKey:         privateKey,
+		PackNodes:          true,
+		RootLogging:        true,
+		LogIntegration:     true,
+		Antispam:           true,
+		CheckpointInterval: 100 * time.Millisecond,
+		BatchMaxAge:        10 * time.Millisecond,
+		PollPeriod:         10 * time.Millisecond,
+	}
+
+	for version := range uint64(2) {
+		d, shutdown, err := Open(t.Context(), dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Keys published before the directory was reopened are still found.
+		res, err := d.Lookup(t.Context(), "dingus", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := res.Version, version; got != want {
+			t.Errorf("Version = %d, want %d", got, want)
+		}
+
+		published, err := d.Publish(t.Context(), "dingus", pubKey, version+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !published.Verify(d.VerifyingKey(), verifier) {
+			t.Error("did not verify")
+		}
+		// Every publish, including a retry, starts a new epoch.
+		if got, want := published.Epoch, 2*version+1; got != want {
+			t.Errorf("Epoch = %d, want %d", got, want)
+		}
+
+		// A retried publish is deduplicated to the original log entry.
+		retried, err := d.Publish(t.Context(), "dingus", pubKey, version+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := retried.LogIndex, published.LogIndex; got != want {
+			t.Errorf("retried LogIndex = %d, want %d", got, want)
+		}
+
+		if err := shutdown(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, mismatched := range map[string]Options{
+		"private key":  {PrivateKey: otherKey, PackNodes: true, RootLogging: true},
+		"origin":       {PrivateKey: privateKey, Origin: "Other", PackNodes: true, RootLogging: true},
+		"node store":   {PrivateKey: privateKey, RootLogging: true},
+		"VRF suite":    {PrivateKey: privateKey, VRFSuite: vrf.TAI, PackNodes: true, RootLogging: true},
+		"root logging": {PrivateKey: privateKey, PackNodes: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := Open(t.Context(), dir, mismatched); !errors.Is(err, ErrManifestMismatch) {
+				t.Errorf("err = %v, want ErrManifestMismatch", err)
+			}
+		})
+	}
+
+	t.Run("no VRF suite", func(t *testing.T) {
+		b, err := os.ReadFile(filepath.Join(dir, manifestFilename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want manifest
+		if err := json.Unmarshal(b, &want); err != nil {
+			t.Fatal(err)
+		}
+
+		// A manifest which doesn't record its VRF suite is rejected rather than assumed to use any suite.
+		root, err := os.OpenRoot(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = root.Close() })
+
+		got := want
+		got.VRFSuite = ""
+		if err := writeManifest(root, &got); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkManifest(root, &want); !errors.Is(err, ErrManifestMismatch) {
+			t.Errorf("err = %v, want ErrManifestMismatch", err)
+		}
+	})
+
+	t.Run("key holder", func(t *testing.T) {
+		kh, err := NewKeyHolder(privateKey, vrf.ELL2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A key holder of the same private key opens the directory, and its suite is used.
+		khOpts := opts
+		khOpts.PrivateKey, khOpts.KeyHolder, khOpts.LogPrivateKey = nil, kh, privateKey
+		d, shutdown, err := Open(t.Context(), dir, khOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = shutdown(t.Context()) })
+
+		res, err := d.Lookup(t.Context(), "dingus", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := res.Version, uint64(2); got != want {
+			t.Errorf("Version = %d, want %d", got, want)
+		}
+		if !res.Verify(d.VerifyingKey(), nil) {
+			t.Error("did not verify")
+		}
+	})
+
+	t.Run("key holder options", func(t *testing.T) {
+		kh, err := NewKeyHolder(privateKey, vrf.ELL2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, invalid := range map[string]Options{
+			"private key":     {PrivateKey: privateKey, KeyHolder: kh, LogPrivateKey: privateKey},
+			"no log key":      {KeyHolder: kh},
+			"VRF suite":       {KeyHolder: kh, LogPrivateKey: privateKey, VRFSuite: vrf.TAI},
+			"other log key":   {KeyHolder: kh, LogPrivateKey: otherKey, PackNodes: true, RootLogging: true},
+			"other VRF key":   {PrivateKey: otherKey, LogPrivateKey: privateKey, PackNodes: true, RootLogging: true},
+			"invalid log key": {PrivateKey: privateKey, LogPrivateKey: otherKey[:10]},
+		} {
+			t.Run(name, func(t *testing.T) {
+				if _, _, err := Open(t.Context(), dir, invalid); err == nil {
+					t.Error("opened the directory")
+				}
+			})
+		}
+	})
+
+	t.Run("temporary manifest", func(t *testing.T) {
+		// A directory whose creation was interrupted while writing its manifest is created when it is reopened.
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, manifestTempFilename), []byte(`{"Ver`), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		_, shutdown, err := Open(t.Context(), dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := shutdown(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, manifestFilename)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("no manifest", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.Mkdir(filepath.Join(dir, "keys"), 0777); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := Open(t.Context(), dir, opts); err == nil {
+			t.Error("opened a directory without a manifest")
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package akd
+
+import (
+	"context"
+
+	"filippo.io/torchwood/prefix"
+	"github.com/codahale/keydonkey/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the tracer which records spans for the directory's operations.
+const tracerName = "github.com/codahale/keydonkey/internal/akd"
+
+// startSpan starts a span with the given name and key version.
+func (d *Directory) startSpan(ctx context.Context, name string, version uint64) (context.Context, trace.Span) {
+	return d.tracer.Start(ctx, name, trace.WithAttributes(attribute.Int64("keydonkey.version", int64(version))))
+}
+
+// endSpan ends the given span, recording the error, if any.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// prove generates a VRF proof and hash from the key ID and version.
+func (d *Directory) prove(ctx context.Context, id string, version uint64) (proof, hash []byte, err error) {
+	ctx, span := d.startSpan(ctx, "vrf.Prove", version)
+	defer func() { endSpan(span, err) }()
+
+	return d.kh.Prove(ctx, vrfInput(id, version))
+}
+
+func (d *Directory) insert(ctx context.Context, label, commitment [32]byte) (err error) {
+	ctx, span := d.tracer.Start(ctx, "prefix.Insert")
+	defer func() { endSpan(span, err) }()
+
+	return d.tree.Insert(ctx, label, commitment)
+}
+
+func (d *Directory) lookupLabel(ctx context.Context, label [32]byte) (found bool, proof []prefix.ProofNode, err error) {
+	ctx, span := d.tracer.Start(ctx, "prefix.Lookup")
+	defer func() {
+		span.SetAttributes(attribute.Bool("keydonkey.found", found), attribute.Int("keydonkey.proof_length", len(proof)))
+		endSpan(span, err)
+	}()
+
+	return d.tree.Lookup(ctx, label)
+}
+
+func (d *Directory) addToLog(ctx context.Context, label, commitment [32]byte) (index uint64, err error) {
+	ctx, span := d.tracer.Start(ctx, "log.Add")
+	defer func() {
+		span.SetAttributes(attribute.Int64("keydonkey.log_index", int64(index)))
+		endSpan(span, err)
+	}()
+
+	return d.log.Add(ctx, label[:], commitment[:])
+}
+
+func (d *Directory) addRootToLog(ctx context.Context, root storage.LogRoot) (index uint64, err error) {
+	ctx, span := d.tracer.Start(ctx, "log.AddRoot", trace.WithAttributes(attribute.Int64("keydonkey.epoch", int64(root.Epoch))))
+	defer func() {
+		span.SetAttributes(attribute.Int64("keydonkey.log_index", int64(index)))
+		endSpan(span, err)
+	}()
+
+	return d.log.(storage.RootLogger).AddRoot(ctx, root)
+}
+
+func (d *Directory) waitForLog(ctx context.Context, index uint64) (inclusion *storage.Inclusion, err error) {
+	ctx, span := d.tracer.Start(ctx, "log.Wait", trace.WithAttributes(attribute.Int64("keydonkey.log_index", int64(index))))
+	defer func() { endSpan(span, err) }()
+
+	return d.log.(storage.LogIntegrator).Wait(ctx, index)
+}
+
+func (d *Directory) getKey(ctx context.Context, id string, minVersion uint64) (found bool, pk []byte, version uint64, err error) {
+	ctx, span := d.startSpan(ctx, "keys.Get", minVersion)
+	defer func() {
+		span.SetAttributes(attribute.Bool("keydonkey.found", found))
+		endSpan(span, err)
+	}()
+
+	return d.keys.Get(ctx, id, minVersion)
+}
+
+// tombstones returns the tombstones of the erased versions of the given ID, or nil if the key store doesn't support
+// erasure.
+func (d *Directory) tombstones(ctx context.Context, id string) (tombstones []storage.Tombstone, err error) {
+	eraser, ok := d.keys.(storage.Eraser)
+	if !ok {
+		return nil, nil
+	}
+
+	ctx, span := d.tracer.Start(ctx, "keys.Tombstones")
+	defer func() {
+		span.SetAttributes(attribute.Int("keydonkey.tombstones", len(tombstones)))
+		endSpan(span, err)
+	}()
+
+	pseudonym, err := d.pseudonym(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return eraser.Tombstones(ctx, pseudonym[:])
+}
+
+func (d *Directory) putKey(ctx context.Context, id string, pk []byte, version uint64) (err error) {
+	ctx, span := d.startSpan(ctx, "keys.Put", version)
+	defer func() { endSpan(span, err) }()
+
+	return d.keys.Put(ctx, id, pk, version)
+}
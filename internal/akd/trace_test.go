@@ -0,0 +1,122 @@
+package akd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"os"
+	"slices"
+	"testing"
+
+	"filippo.io/torchwood/prefix"
+	"github.com/codahale/keydonkey/internal/storage"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTelemetry(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	pubKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	fsKeys, err := storage.NewFSKeyStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = fsKeys.Close() })
+	keys, err := storage.NewInstrumentedKeyStore(fsKeys, mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, err := storage.NewInstrumentedNodeStore(prefix.NewMemoryStorage(), mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prefix.InitStorage(t.Context(), sha256.Sum256, nodes); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := storage.NewInstrumentedLogStore(nopLog{}, mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	akd, err := NewDirectory(privateKey, keys, nodes, log, WithTracerProvider(tp))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := akd.Publish(t.Context(), "dingus", pubKey, 22); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := akd.Lookup(t.Context(), "dingus", 20); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	children := make(map[string][]string)
+	byID := make(map[trace.SpanID]string)
+	for _, span := range spans.Ended() {
+		byID[span.SpanContext().SpanID()] = span.Name()
+	}
+	for _, span := range spans.Ended() {
+		names = append(names, span.Name())
+		if parent, ok := byID[span.Parent().SpanID()]; ok {
+			children[parent] = append(children[parent], span.Name())
+		}
+	}
+	for parent, want := range map[string][]string{
+		"akd.Publish": {"vrf.Prove", "prefix.Insert", "log.Add", "keys.Put", "prefix.Lookup"},
+		"akd.Lookup":  {"keys.Get", "vrf.Prove", "prefix.Lookup"},
+	} {
+		if got := children[parent]; !slices.Equal(got, want) {
+			t.Errorf("children of %s = %v, want %v (all spans: %v)", parent, got, want, names)
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(t.Context(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]uint64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if h, ok := m.Data.(metricdata.Histogram[float64]); ok && m.Name == "keydonkey.storage.duration" {
+				for _, dp := range h.DataPoints {
+					store, _ := dp.Attributes.Value("keydonkey.store")
+					op, _ := dp.Attributes.Value("keydonkey.operation")
+					counts[store.AsString()+"."+op.AsString()] += dp.Count
+				}
+			}
+		}
+	}
+	for _, op := range []string{"keys.get", "keys.put", "nodes.load", "nodes.store", "log.add"} {
+		if counts[op] == 0 {
+			t.Errorf("no duration recorded for %s: %v", op, counts)
+		}
+	}
+}
+
+type nopLog struct{}
+
+func (nopLog) Add(context.Context, []byte, []byte) (uint64, error) {
+	return 0, nil
+}
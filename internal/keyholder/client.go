@@ -0,0 +1,128 @@
+package keyholder
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/codahale/keydonkey/internal/akd"
+	"github.com/codahale/keydonkey/internal/vrf"
+)
+
+// Client is an akd.KeyHolder which forwards requests to a key holder served by NewHandler on a Unix socket. It verifies
+// each proof it receives with the key holder's verifying key, so a faulty key holder cannot corrupt the directory.
+type Client struct {
+	client *http.Client
+	vk     *vrf.VerifyingKey
+}
+
+// Dial connects to the key holder listening on the Unix socket at the given path and fetches its verifying key, which
+// is validated in strict mode. As the key verifies every proof the client receives, a table is precomputed for it.
+func Dial(ctx context.Context, path string) (*Client, error) {
+	var dialer net.Dialer
+	c := &Client{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}
+
+	var res verifyingKeyResponse
+	if err := c.do(ctx, http.MethodGet, "/verifying-key", nil, &res); err != nil {
+		return nil, err
+	}
+
+	vk, err := vrf.NewVerifyingKey(res.PublicKey, vrf.WithSuite(vrf.Suite(res.Suite)), vrf.WithStrictKey(),
+		vrf.WithPrecomputedTable())
+	if err != nil {
+		return nil, fmt.Errorf("keyholder: verifying key: %w", err)
+	}
+	c.vk = vk
+
+	return c, nil
+}
+
+func (c *Client) VerifyingKey() *vrf.VerifyingKey {
+	return c.vk
+}
+
+func (c *Client) Prove(ctx context.Context, alpha []byte) (proof, hash []byte, err error) {
+	var res proveResponse
+	if err := c.do(ctx, http.MethodPost, "/prove", &proveRequest{Alpha: alpha}, &res); err != nil {
+		return nil, nil, err
+	}
+
+	hash, err = c.vk.Verify(alpha, res.Proof)
+	if err != nil {
+		return nil, nil, fmt.Errorf("keyholder: %w", err)
+	}
+	return res.Proof, hash, nil
+}
+
+func (c *Client) Opening(ctx context.Context, label [32]byte, version uint64, pk ed25519.PublicKey) (opening [32]byte, err error) {
+	var res openingResponse
+	req := &openingRequest{Label: label[:], Version: version, PublicKey: pk}
+	if err := c.do(ctx, http.MethodPost, "/opening", req, &res); err != nil {
+		return opening, err
+	}
+
+	if len(res.Opening) != len(opening) {
+		return opening, fmt.Errorf("keyholder: invalid opening length %d", len(res.Opening))
+	}
+	copy(opening[:], res.Opening)
+	return opening, nil
+}
+
+// Close closes the client's idle connections.
+func (c *Client) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// do sends a request with the given JSON body, if any, to the key holder and decodes its JSON response into res.
+func (c *Client) do(ctx context.Context, method, path string, body, res any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	// The host is ignored, as every connection is made to the socket.
+	req, err := http.NewRequestWithContext(ctx, method, "http://keyholder"+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("keyholder: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("keyholder: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return fmt.Errorf("keyholder: %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+var _ akd.KeyHolder = &Client{}
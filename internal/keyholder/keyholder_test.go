@@ -0,0 +1,199 @@
+package keyholder
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"filippo.io/torchwood/prefix"
+	"github.com/codahale/keydonkey/internal/akd"
+	"github.com/codahale/keydonkey/internal/storage"
+	"github.com/codahale/keydonkey/internal/vrf"
+)
+
+func TestClient(t *testing.T) {
+	pubKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local, err := akd.NewKeyHolder(privateKey, vrf.TAI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newTestClient(t, local)
+
+	if got, want := client.VerifyingKey().Suite(), vrf.TAI; got != want {
+		t.Errorf("Suite() = %v, want %v", got, want)
+	}
+
+	got, err := client.VerifyingKey().MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := pubKey; !bytes.Equal(got, want) {
+		t.Errorf("VerifyingKey() = %x, want %x", got, want)
+	}
+
+	proof, hash, err := client.Prove(t.Context(), []byte("alpha"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantProof, wantHash, err := local.Prove(t.Context(), []byte("alpha"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(proof, wantProof) || !bytes.Equal(hash, wantHash) {
+		t.Errorf("Prove() = %x, %x, want %x, %x", proof, hash, wantProof, wantHash)
+	}
+
+	label := sha256.Sum256([]byte("label"))
+	opening, err := client.Opening(t.Context(), label, 22, pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantOpening, err := local.Opening(t.Context(), label, 22, pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opening != wantOpening {
+		t.Errorf("Opening() = %x, want %x", opening, wantOpening)
+	}
+}
+
+func TestClientDirectory(t *testing.T) {
+	pubKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local, err := akd.NewKeyHolder(privateKey, vrf.ELL2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newTestClient(t, local)
+
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	nodes, err := storage.NewFSNodeStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = nodes.Close() })
+	if err := prefix.InitStorage(t.Context(), sha256.Sum256, nodes); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := storage.NewFSKeyStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = keys.Close() })
+
+	if _, err := akd.NewDirectoryWithKeyHolder(client, keys, nodes, &testLog{}, akd.WithVRFSuite(vrf.TAI)); err == nil {
+		t.Error("created a directory with a mismatched VRF suite")
+	}
+
+	d, err := akd.NewDirectoryWithKeyHolder(client, keys, nodes, &testLog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published, err := d.Publish(t.Context(), "dingus", pubKey, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !published.Verify(local.VerifyingKey()) {
+		t.Error("did not verify")
+	}
+
+	res, err := d.Lookup(t.Context(), "dingus", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Found || !res.Verify(local.VerifyingKey(), nil) {
+		t.Errorf("Found = %v, want a verified lookup", res.Found)
+	}
+}
+
+func TestClientFaultyKeyHolder(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local, err := akd.NewKeyHolder(privateKey, vrf.ELL2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := akd.NewKeyHolder(otherKey, vrf.ELL2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newTestClient(t, &faultyKeyHolder{KeyHolder: local, prover: other})
+	if _, _, err := client.Prove(t.Context(), []byte("alpha")); err == nil {
+		t.Error("accepted a proof from another key")
+	}
+}
+
+// newTestClient serves the given key holder on a Unix socket and returns a client connected to it.
+func newTestClient(t *testing.T, kh akd.KeyHolder) *Client {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "keyholder.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(NewHandler(kh))
+	srv.Listener = l
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	client, err := Dial(t.Context(), socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	return client
+}
+
+// faultyKeyHolder proves inputs with a key other than its verifying key.
+type faultyKeyHolder struct {
+	akd.KeyHolder
+	prover akd.Prover
+}
+
+func (kh *faultyKeyHolder) Prove(ctx context.Context, alpha []byte) (proof, hash []byte, err error) {
+	return kh.prover.Prove(ctx, alpha)
+}
+
+// testLog is a LogStore which assigns indexes to entries without storing them.
+type testLog struct {
+	n atomic.Uint64
+}
+
+func (l *testLog) Add(_ context.Context, _, _ []byte) (uint64, error) {
+	return l.n.Add(1) - 1, nil
+}
@@ -0,0 +1,114 @@
+// Package keyholder runs an akd.KeyHolder in a separate process, so that a directory's private key need not be loaded
+// into the directory's process. The key holder serves a small JSON-over-HTTP protocol on a local socket, which Client
+// implements akd.KeyHolder with.
+package keyholder
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/codahale/keydonkey/internal/akd"
+)
+
+// maxRequestSize is the largest request body which the handler reads, in bytes.
+const maxRequestSize = 64 * 1024
+
+type verifyingKeyResponse struct {
+	PublicKey []byte `json:"public_key"`
+	Suite     byte   `json:"suite"`
+}
+
+type proveRequest struct {
+	Alpha []byte `json:"alpha"`
+}
+
+type proveResponse struct {
+	Proof []byte `json:"proof"`
+}
+
+type openingRequest struct {
+	Label     []byte `json:"label"`
+	Version   uint64 `json:"version"`
+	PublicKey []byte `json:"public_key"`
+}
+
+type openingResponse struct {
+	Opening []byte `json:"opening"`
+}
+
+// NewHandler returns an HTTP handler which serves the given key holder's verifying key, proofs, and commitment
+// openings. The handler performs no authentication, so it must only be served on a socket which is accessible to the
+// directory alone.
+func NewHandler(kh akd.KeyHolder) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /verifying-key", func(w http.ResponseWriter, _ *http.Request) {
+		vk := kh.VerifyingKey()
+		publicKey, err := vk.MarshalBinary()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, &verifyingKeyResponse{PublicKey: publicKey, Suite: byte(vk.Suite())})
+	})
+
+	mux.HandleFunc("POST /prove", func(w http.ResponseWriter, r *http.Request) {
+		var req proveRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		proof, _, err := kh.Prove(r.Context(), req.Alpha)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, &proveResponse{Proof: proof})
+	})
+
+	mux.HandleFunc("POST /opening", func(w http.ResponseWriter, r *http.Request) {
+		var req openingRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		var label [32]byte
+		if len(req.Label) != len(label) {
+			http.Error(w, "invalid label", http.StatusBadRequest)
+			return
+		}
+		copy(label[:], req.Label)
+
+		opening, err := kh.Opening(r.Context(), label, req.Version, req.PublicKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, &openingResponse{Opening: opening[:]})
+	})
+
+	return mux
+}
+
+// readJSON decodes the request's body into v. If the body is too large or malformed, it writes an error response and
+// returns false.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(v); err != nil {
+		if maxBytesErr := (*http.MaxBytesError)(nil); errors.As(err, &maxBytesErr) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,250 @@
+// Package logreader reads the entries of a directory's transparency log, verifying them against a signed checkpoint,
+// so that auditors can stream the whole log.
+package logreader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+
+	"github.com/codahale/keydonkey/internal/storage"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/tessera/api"
+	"github.com/transparency-dev/tessera/api/layout"
+	"github.com/transparency-dev/tessera/client"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// ErrMalformedEntry is returned when a log entry cannot be parsed.
+var ErrMalformedEntry = errors.New("logreader: malformed entry")
+
+// EntryType is the type of a log entry.
+type EntryType int
+
+const (
+	// KeyEntry records the insertion of a label and commitment into the prefix tree.
+	KeyEntry EntryType = iota
+
+	// RootEntry records the root hash of the prefix tree as of an epoch.
+	RootEntry
+)
+
+// Entry is a transparency log entry.
+type Entry struct {
+	Index uint64
+	Type  EntryType
+
+	// Label and Commitment are set for key entries.
+	Label      [32]byte
+	Commitment [32]byte
+
+	// Root is set for root entries.
+	Root storage.LogRoot
+}
+
+// ParseEntry parses the data of the log entry with the given index.
+func ParseEntry(index uint64, data []byte) (Entry, error) {
+	switch len(data) {
+	case storage.KeyEntrySize:
+		return Entry{
+			Index:      index,
+			Type:       KeyEntry,
+			Label:      [32]byte(data[:32]),
+			Commitment: [32]byte(data[32:]),
+		}, nil
+	case storage.RootEntrySize:
+		root, err := storage.ParseRootEntry(data)
+		if err != nil {
+			return Entry{}, fmt.Errorf("%w: entry %d: %w", ErrMalformedEntry, index, err)
+		}
+		return Entry{Index: index, Type: RootEntry, Root: root}, nil
+	default:
+		return Entry{}, fmt.Errorf("%w: entry %d is %d bytes long", ErrMalformedEntry, index, len(data))
+	}
+}
+
+// Fetcher reads the resources of a log which follows the tlog-tiles layout.
+type Fetcher interface {
+	// ReadCheckpoint returns the latest signed checkpoint.
+	ReadCheckpoint(ctx context.Context) ([]byte, error)
+
+	// ReadTile returns the hash tile at the given level and index, with a partial width of p, if non-zero.
+	ReadTile(ctx context.Context, level, index uint64, p uint8) ([]byte, error)
+
+	// ReadEntryBundle returns the entry bundle at the given index, with a partial width of p, if non-zero.
+	ReadEntryBundle(ctx context.Context, index uint64, p uint8) ([]byte, error)
+}
+
+// NewFileFetcher returns a Fetcher which reads a log stored in the given directory, such as one written by tessera's
+// POSIX driver.
+func NewFileFetcher(dir string) Fetcher {
+	return client.FileFetcher{Root: dir}
+}
+
+// NewHTTPFetcher returns a Fetcher which reads a log served via HTTP at the given URL. If c is nil,
+// http.DefaultClient is used.
+func NewHTTPFetcher(rootURL string, c *http.Client) (Fetcher, error) {
+	u, err := url.Parse(rootURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.NewHTTPFetcher(u, c)
+}
+
+// Reader reads entries from a log, verifying them against the log's signed checkpoints.
+type Reader struct {
+	f        Fetcher
+	verifier note.Verifier
+
+	// Workers is the number of entry bundles fetched concurrently.
+	Workers uint
+}
+
+// NewReader returns a Reader which reads from the given Fetcher. Checkpoints must be signed by the given verifier,
+// whose name must be the log's origin.
+func NewReader(f Fetcher, verifier note.Verifier) *Reader {
+	return &Reader{f: f, verifier: verifier, Workers: 4}
+}
+
+// Checkpoint fetches the log's latest checkpoint and verifies its signature.
+func (r *Reader) Checkpoint(ctx context.Context) (*log.Checkpoint, error) {
+	b, err := r.f.ReadCheckpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.OpenCheckpoint(b, r.verifier)
+}
+
+// Entries returns an iterator over the log's entries from the given index up to the size of the given checkpoint,
+// which must have been verified. Each entry bundle is verified against the checkpoint before its entries are yielded;
+// iteration stops at the first error.
+func (r *Reader) Entries(ctx context.Context, cp *log.Checkpoint, start uint64) iter.Seq2[Entry, error] {
+	return func(yield func(Entry, error) bool) {
+		if start > cp.Size {
+			yield(Entry{}, fmt.Errorf("logreader: start %d is beyond checkpoint size %d", start, cp.Size))
+			return
+		}
+
+		pb, err := client.NewProofBuilder(ctx, cp.Size, r.f.ReadTile)
+		if err != nil {
+			yield(Entry{}, err)
+			return
+		}
+
+		// The entries are appended to a compact range covering the log from its start. The nodes covering the entries
+		// before the starting index are read from the log's tiles, and are verified along with the first bundle.
+		rf := &compact.RangeFactory{Hash: rfc6962.DefaultHasher.HashChildren}
+		hashes, err := client.FetchRangeNodes(ctx, start, r.f.ReadTile)
+		if err != nil {
+			yield(Entry{}, err)
+			return
+		}
+		cr, err := rf.NewRange(0, start, hashes)
+		if err != nil {
+			yield(Entry{}, err)
+			return
+		}
+
+		getSize := func(context.Context) (uint64, error) { return cp.Size, nil }
+		for b, err := range client.EntryBundles(ctx, r.Workers, getSize, r.f.ReadEntryBundle, start, cp.Size-start) {
+			if err != nil {
+				yield(Entry{}, err)
+				return
+			}
+
+			entries, err := r.verifyBundle(ctx, pb, cr, cp, b)
+			if err != nil {
+				yield(Entry{}, err)
+				return
+			}
+
+			for _, e := range entries {
+				if !yield(e, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// verifyBundle parses the entries of the given bundle and appends them to the compact range, then verifies that the
+// range is consistent with the checkpoint.
+func (r *Reader) verifyBundle(ctx context.Context, pb *client.ProofBuilder, cr *compact.Range, cp *log.Checkpoint, b client.Bundle) ([]Entry, error) {
+	var bundle api.EntryBundle
+	if err := bundle.UnmarshalText(b.Data); err != nil {
+		return nil, fmt.Errorf("logreader: entry bundle %d: %w", b.RangeInfo.Index, err)
+	}
+	if len(bundle.Entries) < int(b.RangeInfo.First+b.RangeInfo.N) {
+		return nil, fmt.Errorf("logreader: entry bundle %d has %d entries, want at least %d",
+			b.RangeInfo.Index, len(bundle.Entries), b.RangeInfo.First+b.RangeInfo.N)
+	}
+
+	entries := make([]Entry, 0, b.RangeInfo.N)
+	for _, data := range bundle.Entries[b.RangeInfo.First : b.RangeInfo.First+b.RangeInfo.N] {
+		index := cr.End()
+		if err := cr.Append(rfc6962.DefaultHasher.HashLeaf(data), nil); err != nil {
+			return nil, err
+		}
+
+		e, err := ParseEntry(index, data)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	// Prove that the log up to the end of the bundle is a prefix of the checkpoint's log.
+	root, err := cr.GetRootHash(nil)
+	if err != nil {
+		return nil, err
+	}
+	consistency, err := pb.ConsistencyProof(ctx, cr.End(), cp.Size)
+	if err != nil {
+		return nil, err
+	}
+	if err := proof.VerifyConsistency(rfc6962.DefaultHasher, cr.End(), cp.Size, consistency, root, cp.Hash); err != nil {
+		return nil, fmt.Errorf("logreader: entry bundle %d does not match checkpoint: %w", b.RangeInfo.Index, err)
+	}
+
+	return entries, nil
+}
+
+// Entry reads the log entry with the given index and verifies its inclusion in the given checkpoint, which must have
+// been verified.
+func (r *Reader) Entry(ctx context.Context, cp *log.Checkpoint, index uint64) (Entry, error) {
+	if index >= cp.Size {
+		return Entry{}, fmt.Errorf("logreader: index %d is beyond checkpoint size %d", index, cp.Size)
+	}
+
+	bundle, err := client.GetEntryBundle(ctx, r.f.ReadEntryBundle, index/layout.EntryBundleWidth, cp.Size)
+	if err != nil {
+		return Entry{}, err
+	}
+	offset := index % layout.EntryBundleWidth
+	if offset >= uint64(len(bundle.Entries)) {
+		return Entry{}, fmt.Errorf("logreader: entry bundle %d has %d entries", index/layout.EntryBundleWidth, len(bundle.Entries))
+	}
+	data := bundle.Entries[offset]
+
+	pb, err := client.NewProofBuilder(ctx, cp.Size, r.f.ReadTile)
+	if err != nil {
+		return Entry{}, err
+	}
+	inclusion, err := pb.InclusionProof(ctx, index)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := proof.VerifyInclusion(rfc6962.DefaultHasher, index, cp.Size, rfc6962.DefaultHasher.HashLeaf(data), inclusion, cp.Hash); err != nil {
+		return Entry{}, fmt.Errorf("logreader: entry %d does not match checkpoint: %w", index, err)
+	}
+
+	return ParseEntry(index, data)
+}
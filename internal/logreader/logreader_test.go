@@ -0,0 +1,138 @@
+package logreader
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codahale/keydonkey/internal/storage"
+	"github.com/transparency-dev/tessera"
+	"github.com/transparency-dev/tessera/storage/posix"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestReader(t *testing.T) {
+	skey, vkey, err := note.GenerateKey(rand.Reader, "KeyDonkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "log")
+	driver, err := posix.New(t.Context(), posix.Config{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appender, shutdown, reader, err := tessera.NewAppender(t.Context(), driver, tessera.NewAppendOptions().
+		WithCheckpointSigner(signer).
+		WithCheckpointInterval(100*time.Millisecond).
+		WithBatching(512, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := shutdown(t.Context()); err != nil {
+			t.Log(err)
+		}
+	})
+
+	// Write enough entries to fill more than one entry bundle, and wait for them to be integrated.
+	const n = 300
+	log := storage.NewIntegratingTesseraLog(t.Context(), appender, reader, nil, 10*time.Millisecond)
+	entries := make([]Entry, n)
+	for i := range entries {
+		entries[i].Index = uint64(i)
+		_, _ = rand.Read(entries[i].Label[:])
+		_, _ = rand.Read(entries[i].Commitment[:])
+		if _, err := log.Add(t.Context(), entries[i].Label[:], entries[i].Commitment[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last := entries[n-1]
+	if _, err := log.(storage.LogIntegrator).AddAndWait(t.Context(), last.Label[:], last.Commitment[:]); err != nil {
+		t.Fatal(err)
+	}
+	entries = append(entries, Entry{Index: n, Label: last.Label, Commitment: last.Commitment})
+
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	t.Cleanup(server.Close)
+	httpFetcher, err := NewHTTPFetcher(server.URL, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, f := range map[string]Fetcher{
+		"file": NewFileFetcher(dir),
+		"http": httpFetcher,
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := NewReader(f, verifier)
+			cp, err := r.Checkpoint(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := cp.Size, uint64(len(entries)); got != want {
+				t.Fatalf("checkpoint size = %d, want %d", got, want)
+			}
+
+			for _, start := range []uint64{0, 1, 256, n} {
+				i := start
+				for e, err := range r.Entries(t.Context(), cp, start) {
+					if err != nil {
+						t.Fatal(err)
+					}
+					if e != entries[i] {
+						t.Fatalf("entry %d = %+v, want %+v", i, e, entries[i])
+					}
+					i++
+				}
+				if i != cp.Size {
+					t.Errorf("read entries [%d, %d), want [%d, %d)", start, i, start, cp.Size)
+				}
+			}
+
+			tampered := NewReader(tamperingFetcher{f}, verifier)
+			for _, err := range tampered.Entries(t.Context(), cp, 0) {
+				if err == nil {
+					t.Fatal("read tampered entry")
+				}
+				break
+			}
+		})
+	}
+
+	if _, err := ParseEntry(0, make([]byte, storage.KeyEntrySize-1)); !errors.Is(err, ErrMalformedEntry) {
+		t.Errorf("ParseEntry error = %v, want %v", err, ErrMalformedEntry)
+	}
+}
+
+// tamperingFetcher flips a bit in the last byte of each entry bundle.
+type tamperingFetcher struct {
+	Fetcher
+}
+
+func (f tamperingFetcher) ReadEntryBundle(ctx context.Context, index uint64, p uint8) ([]byte, error) {
+	b, err := f.Fetcher.ReadEntryBundle(ctx, index, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty entry bundle %d", index)
+	}
+	b[len(b)-1] ^= 1
+	return b, nil
+}
@@ -0,0 +1,66 @@
+package logreader
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"iter"
+
+	"filippo.io/torchwood/prefix"
+)
+
+// ErrRootMismatch is returned by Replay when a root entry does not match the replayed prefix tree.
+var ErrRootMismatch = errors.New("logreader: logged root does not match replayed tree")
+
+// ReplayStats records the results of a replay.
+type ReplayStats struct {
+	// Keys is the number of key entries inserted into the tree.
+	Keys int
+
+	// Roots is the number of root entries verified.
+	Roots int
+}
+
+// Replay inserts the label and commitment of every key entry into a prefix tree, and verifies that every root entry
+// records the root hash of the tree as of that entry, with epochs which increase by one. The entries must start at the
+// beginning of the log, and the tree's storage must be empty.
+func Replay(ctx context.Context, entries iter.Seq2[Entry, error], nodes prefix.Storage) (ReplayStats, error) {
+	var stats ReplayStats
+
+	if err := prefix.InitStorage(ctx, sha256.Sum256, nodes); err != nil {
+		return stats, err
+	}
+	tree := prefix.NewTree(sha256.Sum256, nodes)
+
+	var epoch uint64
+	for e, err := range entries {
+		if err != nil {
+			return stats, err
+		}
+
+		switch e.Type {
+		case KeyEntry:
+			if err := tree.Insert(ctx, e.Label, e.Commitment); err != nil {
+				return stats, fmt.Errorf("logreader: replaying entry %d: %w", e.Index, err)
+			}
+			stats.Keys++
+		case RootEntry:
+			if epoch != 0 && e.Root.Epoch != epoch+1 {
+				return stats, fmt.Errorf("%w: entry %d has epoch %d, want %d", ErrRootMismatch, e.Index, e.Root.Epoch, epoch+1)
+			}
+			epoch = e.Root.Epoch
+
+			rootHash, err := tree.RootHash(ctx)
+			if err != nil {
+				return stats, err
+			}
+			if rootHash != e.Root.Hash {
+				return stats, fmt.Errorf("%w: entry %d for epoch %d", ErrRootMismatch, e.Index, e.Root.Epoch)
+			}
+			stats.Roots++
+		}
+	}
+
+	return stats, nil
+}
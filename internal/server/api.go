@@ -0,0 +1,210 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"filippo.io/torchwood/prefix"
+	"github.com/codahale/keydonkey/internal/akd"
+)
+
+// The API's requests and responses are JSON objects with the fields below. Byte strings are encoded in standard,
+// padded base64, and fields are only ever added, never renamed or removed. Errors are returned as an ErrorResponse
+// with a non-2xx status code.
+
+// ErrorResponse describes why a request failed.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// PublishRequest is the body of a POST /v1/publish request.
+type PublishRequest struct {
+	ID        string `json:"id"`
+	Version   uint64 `json:"version"`
+	PublicKey []byte `json:"public_key"`
+}
+
+// ProofNode is a sibling node in a prefix tree membership or non-membership proof.
+type ProofNode struct {
+	BitLen uint32 `json:"bit_len"`
+	Label  []byte `json:"label"`
+	Hash   []byte `json:"hash"`
+}
+
+// PublishResponse is the response to a POST /v1/publish request, encoding an akd.PublishResult.
+type PublishResponse struct {
+	ID              string      `json:"id"`
+	Version         uint64      `json:"version"`
+	PublicKey       []byte      `json:"public_key"`
+	MembershipProof []ProofNode `json:"membership_proof"`
+	RootHash        []byte      `json:"root_hash"`
+	IndexProof      []byte      `json:"index_proof"`
+	IndexOpening    []byte      `json:"index_opening"`
+	LogIndex        uint64      `json:"log_index"`
+	Checkpoint      []byte      `json:"checkpoint,omitempty"`
+	InclusionProof  [][]byte    `json:"inclusion_proof,omitempty"`
+	Epoch           uint64      `json:"epoch"`
+	RootLogIndex    uint64      `json:"root_log_index"`
+}
+
+// LookupResponse is the response to a GET /v1/lookup request, encoding an akd.LookupResult.
+type LookupResponse struct {
+	ID              string      `json:"id"`
+	Version         uint64      `json:"version"`
+	PublicKey       []byte      `json:"public_key,omitempty"`
+	MembershipProof []ProofNode `json:"membership_proof"`
+	RootHash        []byte      `json:"root_hash"`
+	Found           bool        `json:"found"`
+	Erased          bool        `json:"erased"`
+	Commitment      []byte      `json:"commitment,omitempty"`
+	IndexProof      []byte      `json:"index_proof"`
+	IndexOpening    []byte      `json:"index_opening,omitempty"`
+	Epoch           uint64      `json:"epoch"`
+	RootLogIndex    uint64      `json:"root_log_index"`
+}
+
+// HistoryResponse is the response to a GET /v1/history request, with a result for every stored version of a key in
+// ascending order of version.
+type HistoryResponse struct {
+	Results []*LookupResponse `json:"results"`
+}
+
+// VerifyingKeyResponse is the response to a GET /v1/verifying-key request.
+type VerifyingKeyResponse struct {
+	// VRFKey is the directory's VRF verifying key as a JWK, which records its suite.
+	VRFKey json.RawMessage `json:"vrf_key"`
+
+	// LogKey is the verifier key of the directory's transparency log, in note format.
+	LogKey string `json:"log_key"`
+}
+
+func newPublishResponse(r *akd.PublishResult) *PublishResponse {
+	return &PublishResponse{
+		ID:              r.ID,
+		Version:         r.Version,
+		PublicKey:       r.PublicKey,
+		MembershipProof: newProofNodes(r.MembershipProof),
+		RootHash:        r.RootHash[:],
+		IndexProof:      r.IndexProof,
+		IndexOpening:    r.IndexOpening,
+		LogIndex:        r.LogIndex,
+		Checkpoint:      r.Checkpoint,
+		InclusionProof:  r.InclusionProof,
+		Epoch:           r.Epoch,
+		RootLogIndex:    r.RootLogIndex,
+	}
+}
+
+// Result decodes the response into an akd.PublishResult, which can then be verified.
+func (r *PublishResponse) Result() (*akd.PublishResult, error) {
+	membershipProof, err := parseProofNodes(r.MembershipProof)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &akd.PublishResult{
+		ID:              r.ID,
+		Version:         r.Version,
+		PublicKey:       r.PublicKey,
+		MembershipProof: membershipProof,
+		IndexProof:      r.IndexProof,
+		IndexOpening:    r.IndexOpening,
+		LogIndex:        r.LogIndex,
+		Checkpoint:      r.Checkpoint,
+		InclusionProof:  r.InclusionProof,
+		Epoch:           r.Epoch,
+		RootLogIndex:    r.RootLogIndex,
+	}
+	if err := parseHash(&res.RootHash, r.RootHash); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func newLookupResponse(r *akd.LookupResult) *LookupResponse {
+	return &LookupResponse{
+		ID:              r.ID,
+		Version:         r.Version,
+		PublicKey:       r.PublicKey,
+		MembershipProof: newProofNodes(r.MembershipProof),
+		RootHash:        r.RootHash[:],
+		Found:           r.Found,
+		Erased:          r.Erased,
+		Commitment:      r.Commitment,
+		IndexProof:      r.IndexProof,
+		IndexOpening:    r.IndexOpening,
+		Epoch:           r.Epoch,
+		RootLogIndex:    r.RootLogIndex,
+	}
+}
+
+// Result decodes the response into an akd.LookupResult, which can then be verified.
+func (r *LookupResponse) Result() (*akd.LookupResult, error) {
+	membershipProof, err := parseProofNodes(r.MembershipProof)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &akd.LookupResult{
+		ID:              r.ID,
+		Version:         r.Version,
+		PublicKey:       r.PublicKey,
+		MembershipProof: membershipProof,
+		Found:           r.Found,
+		Erased:          r.Erased,
+		Commitment:      r.Commitment,
+		IndexProof:      r.IndexProof,
+		IndexOpening:    r.IndexOpening,
+		Epoch:           r.Epoch,
+		RootLogIndex:    r.RootLogIndex,
+	}
+	if err := parseHash(&res.RootHash, r.RootHash); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// History decodes the response into akd.LookupResults, which can then be verified with akd.VerifyHistory.
+func (r *HistoryResponse) History() ([]*akd.LookupResult, error) {
+	results := make([]*akd.LookupResult, len(r.Results))
+	for i, encoded := range r.Results {
+		res, err := encoded.Result()
+		if err != nil {
+			return nil, err
+		}
+		results[i] = res
+	}
+	return results, nil
+}
+
+func newProofNodes(nodes []prefix.ProofNode) []ProofNode {
+	encoded := make([]ProofNode, len(nodes))
+	for i, n := range nodes {
+		encoded[i] = ProofNode{BitLen: n.Label.BitLen(), Label: n.Label.Bytes(), Hash: n.Hash[:]}
+	}
+	return encoded
+}
+
+func parseProofNodes(encoded []ProofNode) ([]prefix.ProofNode, error) {
+	nodes := make([]prefix.ProofNode, len(encoded))
+	for i, n := range encoded {
+		label, err := prefix.NewLabel(n.BitLen, n.Label)
+		if err != nil {
+			return nil, fmt.Errorf("server: invalid proof node %d: %w", i, err)
+		}
+		nodes[i].Label = label
+		if err := parseHash(&nodes[i].Hash, n.Hash); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+func parseHash(dst *[32]byte, b []byte) error {
+	if len(b) != len(dst) {
+		return errors.New("server: invalid hash length")
+	}
+	copy(dst[:], b)
+	return nil
+}
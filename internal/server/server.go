@@ -0,0 +1,198 @@
+// Package server serves a directory's JSON-over-HTTP API, with which clients publish and look up keys, list the
+// history of a key, and fetch the directory's verifying keys and the latest checkpoint of its transparency log.
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/codahale/keydonkey/internal/akd"
+)
+
+// maxRequestSize is the largest request body which the handler reads, in bytes.
+const maxRequestSize = 64 * 1024
+
+// statusClientClosedRequest is the non-standard status with which a request is logged when the client disconnects before
+// the response is written.
+const statusClientClosedRequest = 499
+
+// DefaultTimeout is the deadline of each request's directory operation, unless another is given.
+const DefaultTimeout = 30 * time.Second
+
+// NewHandler returns an HTTP handler which serves the given directory's API:
+//
+//   - POST /v1/publish publishes the key in a PublishRequest, returning a PublishResponse.
+//   - GET /v1/lookup?id=...&min_version=... looks up the latest version of a key, returning a LookupResponse.
+//   - GET /v1/history?id=... looks up every stored version of a key, returning a HistoryResponse.
+//   - GET /v1/verifying-key returns a VerifyingKeyResponse with the directory's VRF key and the given log verifier key.
+//   - GET /v1/checkpoint returns the latest signed checkpoint of the directory's transparency log, as text.
+//
+// Each directory operation is cancelled if it takes longer than the given timeout. If the timeout is zero,
+// DefaultTimeout is used. The handler performs no authentication, so publishing must be restricted by other means.
+func NewHandler(d *akd.Directory, logKey string, timeout time.Duration) (http.Handler, error) {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	vrfKey, err := d.VerifyingKey().MarshalJWK()
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /v1/publish", func(w http.ResponseWriter, r *http.Request) {
+		var req PublishRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if req.ID == "" {
+			writeError(w, http.StatusBadRequest, errors.New("missing id"))
+			return
+		}
+		if req.Version == 0 {
+			writeError(w, http.StatusBadRequest, errors.New("version must be positive"))
+			return
+		}
+		if len(req.PublicKey) != ed25519.PublicKeySize {
+			writeError(w, http.StatusBadRequest, errors.New("invalid public key"))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		res, err := d.Publish(ctx, req.ID, req.PublicKey, req.Version)
+		if err != nil {
+			writeDirectoryError(w, err)
+			return
+		}
+
+		writeJSON(w, newPublishResponse(res))
+	})
+
+	mux.HandleFunc("GET /v1/lookup", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := readID(w, r)
+		if !ok {
+			return
+		}
+
+		var minVersion uint64
+		if s := r.URL.Query().Get("min_version"); s != "" {
+			v, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, errors.New("invalid min_version"))
+				return
+			}
+			minVersion = v
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		res, err := d.Lookup(ctx, id, minVersion)
+		if err != nil {
+			writeDirectoryError(w, err)
+			return
+		}
+
+		writeJSON(w, newLookupResponse(res))
+	})
+
+	mux.HandleFunc("GET /v1/history", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := readID(w, r)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		results, err := d.History(ctx, id)
+		if err != nil {
+			writeDirectoryError(w, err)
+			return
+		}
+
+		resp := &HistoryResponse{Results: make([]*LookupResponse, len(results))}
+		for i, res := range results {
+			resp.Results[i] = newLookupResponse(res)
+		}
+		writeJSON(w, resp)
+	})
+
+	mux.HandleFunc("GET /v1/verifying-key", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, &VerifyingKeyResponse{VRFKey: vrfKey, LogKey: logKey})
+	})
+
+	mux.HandleFunc("GET /v1/checkpoint", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		checkpoint, err := d.Checkpoint(ctx)
+		if err != nil {
+			writeDirectoryError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = w.Write(checkpoint)
+	})
+
+	return mux, nil
+}
+
+// readID returns the request's id query parameter. If it is missing, it writes an error response and returns false.
+func readID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing id"))
+		return "", false
+	}
+	return id, true
+}
+
+// readJSON decodes the request's body into v. If the body is too large or malformed, it writes an error response and
+// returns false.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(v); err != nil {
+		if maxBytesErr := (*http.MaxBytesError)(nil); errors.As(err, &maxBytesErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+		} else {
+			writeError(w, http.StatusBadRequest, err)
+		}
+		return false
+	}
+	return true
+}
+
+// writeDirectoryError writes an error response for an error returned by the directory.
+func writeDirectoryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, akd.ErrHistoryUnsupported), errors.Is(err, akd.ErrCheckpointUnsupported):
+		writeError(w, http.StatusNotImplemented, err)
+	case errors.Is(err, context.Canceled):
+		writeError(w, statusClientClosedRequest, err)
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusServiceUnavailable, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(&ErrorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
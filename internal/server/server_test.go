@@ -0,0 +1,301 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codahale/keydonkey/internal/akd"
+	"github.com/codahale/keydonkey/internal/storage"
+	"github.com/codahale/keydonkey/internal/vrf"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestServer(t *testing.T) {
+	pubKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, shutdown, err := akd.Open(t.Context(), filepath.Join(t.TempDir(), "directory"), akd.Options{
+		PrivateKey:         privateKey,
+		VRFSuite:           vrf.TAI,
+		RootLogging:        true,
+		LogIntegration:     true,
+		CheckpointInterval: 100 * time.Millisecond,
+		BatchMaxAge:        10 * time.Millisecond,
+		PollPeriod:         10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := shutdown(context.Background()); err != nil {
+			t.Log(err)
+		}
+	})
+
+	logKey, err := storage.EncodeVerifierKey(akd.DefaultOrigin, privateKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewHandler(d, logKey, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	// Clients fetch the directory's keys, which they verify every response with.
+	var keys VerifyingKeyResponse
+	get(t, srv.URL+"/v1/verifying-key", http.StatusOK, &keys)
+
+	vk, err := vrf.ParseJWKVerifyingKey(keys.VRFKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := vk.Suite(), vrf.TAI; got != want {
+		t.Errorf("Suite() = %v, want %v", got, want)
+	}
+
+	verifier, err := note.NewVerifier(keys.LogKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missing := lookup(t, srv.URL+"/v1/lookup?id=dingus", vk)
+	if missing.Found {
+		t.Error("found an unpublished key")
+	}
+
+	var logIndex uint64
+	for version := range uint64(2) {
+		var published PublishResponse
+		post(t, srv.URL+"/v1/publish", &PublishRequest{ID: "dingus", Version: version + 1, PublicKey: pubKey},
+			http.StatusOK, &published)
+
+		res, err := published.Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Verify(vk, verifier) {
+			t.Error("did not verify")
+		}
+		if got, want := res.Epoch, version+1; got != want {
+			t.Errorf("Epoch = %d, want %d", got, want)
+		}
+		logIndex = res.LogIndex
+	}
+
+	found := lookup(t, srv.URL+"/v1/lookup?id=dingus&min_version=1", vk)
+	if !found.Found || found.Version != 2 || !found.PublicKey.Equal(pubKey) {
+		t.Errorf("lookup = found %v, version %d, public key %x, want version 2 of %x", found.Found, found.Version,
+			found.PublicKey, pubKey)
+	}
+
+	var history HistoryResponse
+	get(t, srv.URL+"/v1/history?id="+url.QueryEscape("dingus"), http.StatusOK, &history)
+	if got, want := len(history.Results), 2; got != want {
+		t.Fatalf("len(Results) = %d, want %d", got, want)
+	}
+	results, err := history.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		if res.Version != uint64(i+1) {
+			t.Errorf("Results[%d] = version %d, want version %d", i, res.Version, i+1)
+		}
+	}
+	if !akd.VerifyHistory(vk, results, nil) {
+		t.Error("history did not verify")
+	}
+
+	resp, err := http.Get(srv.URL + "/v1/checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := storage.OpenCheckpoint(checkpoint, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Size <= logIndex {
+		t.Errorf("checkpoint size = %d, want more than %d", cp.Size, logIndex)
+	}
+
+	oversized := `{"id":"` + strings.Repeat("a", maxRequestSize) + `"}`
+	for name, tc := range map[string]struct {
+		method, path string
+		body         string
+		status       int
+	}{
+		"missing id":          {"GET", "/v1/lookup", "", http.StatusBadRequest},
+		"invalid min_version": {"GET", "/v1/lookup?id=dingus&min_version=-1", "", http.StatusBadRequest},
+		"history missing id":  {"GET", "/v1/history", "", http.StatusBadRequest},
+		"malformed body":      {"POST", "/v1/publish", "{", http.StatusBadRequest},
+		"zero version":        {"POST", "/v1/publish", `{"id":"dingus","public_key":"` + base64.StdEncoding.EncodeToString(pubKey) + `"}`, http.StatusBadRequest},
+		"short public key":    {"POST", "/v1/publish", `{"id":"dingus","version":3,"public_key":"AAAA"}`, http.StatusBadRequest},
+		"oversized body":      {"POST", "/v1/publish", oversized, http.StatusRequestEntityTooLarge},
+		"wrong method":        {"GET", "/v1/publish", "", http.StatusMethodNotAllowed},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(t.Context(), tc.method, srv.URL+tc.path, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if got, want := resp.StatusCode, tc.status; got != want {
+				t.Errorf("status = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestConcurrentPublish(t *testing.T) {
+	pubKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, shutdown, err := akd.Open(t.Context(), filepath.Join(t.TempDir(), "directory"), akd.Options{
+		PrivateKey:         privateKey,
+		CheckpointInterval: 100 * time.Millisecond,
+		BatchMaxAge:        10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := shutdown(context.Background()); err != nil {
+			t.Log(err)
+		}
+	})
+
+	h, err := NewHandler(d, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	var wg sync.WaitGroup
+	for i := range 64 {
+		wg.Go(func() {
+			b, err := json.Marshal(&PublishRequest{ID: fmt.Sprintf("dingus %d", i), Version: 1, PublicKey: pubKey})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp, err := http.Post(srv.URL+"/v1/publish", "application/json", bytes.NewReader(b))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = resp.Body.Close()
+			if got, want := resp.StatusCode, http.StatusOK; got != want {
+				t.Errorf("status = %d, want %d", got, want)
+			}
+		})
+	}
+	wg.Wait()
+
+	vk := d.VerifyingKey()
+	for i := range 64 {
+		if res := lookup(t, srv.URL+"/v1/lookup?id="+url.QueryEscape(fmt.Sprintf("dingus %d", i)), vk); !res.Found {
+			t.Errorf("dingus %d was not found", i)
+		}
+	}
+}
+
+func TestWriteDirectoryError(t *testing.T) {
+	for err, want := range map[error]int{
+		akd.ErrHistoryUnsupported:                           http.StatusNotImplemented,
+		fmt.Errorf("wrapped: %w", context.Canceled):         statusClientClosedRequest,
+		fmt.Errorf("wrapped: %w", context.DeadlineExceeded): http.StatusServiceUnavailable,
+		errors.New("something else"):                        http.StatusInternalServerError,
+	} {
+		w := httptest.NewRecorder()
+		writeDirectoryError(w, err)
+		if got := w.Code; got != want {
+			t.Errorf("writeDirectoryError(%v) status = %d, want %d", err, got, want)
+		}
+	}
+}
+
+// lookup fetches the given lookup URL and returns the verified result.
+func lookup(t *testing.T, target string, vk *vrf.VerifyingKey) *akd.LookupResult {
+	t.Helper()
+
+	var r LookupResponse
+	get(t, target, http.StatusOK, &r)
+	res, err := r.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Verify(vk, nil) {
+		t.Error("did not verify")
+	}
+	return res
+}
+
+func get(t *testing.T, target string, status int, v any) {
+	t.Helper()
+
+	resp, err := http.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode(t, resp, status, v)
+}
+
+func post(t *testing.T, target string, body any, status int, v any) {
+	t.Helper()
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(target, "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode(t, resp, status, v)
+}
+
+func decode(t *testing.T, resp *http.Response, status int, v any) {
+	t.Helper()
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != status {
+		var e ErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		t.Fatalf("status = %d (%s), want %d", resp.StatusCode, e.Error, status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
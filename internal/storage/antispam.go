@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/transparency-dev/tessera"
+	"github.com/transparency-dev/tessera/api/layout"
+	"github.com/transparency-dev/tessera/client"
+)
+
+// FSAntispam is a tessera.Antispam which resolves entries to the index of an identical entry already in the log. It
+// follows the log's integrated entries, appending their identity hashes to a file so that the index survives restarts.
+// Entries which have not yet been followed are only deduplicated by the appender's in-memory cache.
+//
+// An Appender is configured to use an FSAntispam with tessera.AppendOptions.WithAntispam.
+type FSAntispam struct {
+	root       *os.Root
+	pollPeriod time.Duration
+
+	mu      sync.RWMutex
+	f       *os.File
+	indices map[[32]byte]uint64
+	next    uint64
+}
+
+// NewFSAntispam opens or creates an FSAntispam in the "antispam" directory of the given root. The log is polled for
+// newly integrated entries every pollPeriod. If the index ends with a partially-written record, the record is
+// discarded and the entry is followed again.
+func NewFSAntispam(root *os.Root, pollPeriod time.Duration) (*FSAntispam, error) {
+	if err := root.Mkdir("antispam", 0777); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, err
+	}
+
+	root, err := root.OpenRoot("antispam")
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := root.OpenFile(antispamFilename, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		_ = root.Close()
+		return nil, err
+	}
+
+	a := &FSAntispam{
+		root:       root,
+		pollPeriod: pollPeriod,
+		f:          f,
+		indices:    make(map[[32]byte]uint64),
+	}
+	if err := a.read(); err != nil {
+		_ = a.Close()
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Decorator returns a function which decorates an Appender's Add function to return the index of an identical entry,
+// if one has been followed.
+func (a *FSAntispam) Decorator() func(tessera.AddFn) tessera.AddFn {
+	return func(delegate tessera.AddFn) tessera.AddFn {
+		return func(ctx context.Context, e *tessera.Entry) tessera.IndexFuture {
+			a.mu.RLock()
+			index, ok := a.indices[antispamKey(e.Identity())]
+			a.mu.RUnlock()
+
+			if ok {
+				return func() (tessera.Index, error) {
+					return tessera.Index{Index: index, IsDup: true}, nil
+				}
+			}
+			return delegate(ctx, e)
+		}
+	}
+}
+
+// Follower returns a tessera.Follower which adds the identity hashes of the log's entries to the index, using the
+// given function to extract them from entry bundles.
+func (a *FSAntispam) Follower(hasher func([]byte) ([][]byte, error)) tessera.Follower {
+	return &fsAntispamFollower{a: a, hasher: hasher}
+}
+
+// Close closes the index. It must not be called until the Appender using it has been shut down.
+func (a *FSAntispam) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return errors.Join(a.f.Close(), a.root.Close())
+}
+
+// read loads the identity hashes in the index, truncating any partially-written record.
+func (a *FSAntispam) read() error {
+	b, err := io.ReadAll(a.f)
+	if err != nil {
+		return err
+	}
+
+	n := len(b) / sha256.Size
+	if err := a.f.Truncate(int64(n * sha256.Size)); err != nil {
+		return err
+	}
+	if _, err := a.f.Seek(int64(n*sha256.Size), io.SeekStart); err != nil {
+		return err
+	}
+
+	for ; len(b) >= sha256.Size; b = b[sha256.Size:] {
+		a.add([32]byte(b))
+	}
+	return nil
+}
+
+// write durably appends the given identity hashes to the index.
+func (a *FSAntispam) write(keys [][32]byte) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	b := make([]byte, 0, len(keys)*sha256.Size)
+	for _, key := range keys {
+		b = append(b, key[:]...)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.f.Write(b); err != nil {
+		return err
+	}
+	if err := a.f.Sync(); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		a.add(key)
+	}
+	return nil
+}
+
+// add records the identity hash of the next entry. If the log already contains an identical entry, the earlier index
+// is kept. The caller must hold a.mu for writing.
+func (a *FSAntispam) add(key [32]byte) {
+	if _, ok := a.indices[key]; !ok {
+		a.indices[key] = a.next
+	}
+	a.next++
+}
+
+const antispamFilename = "index"
+
+// antispamKey returns the fixed-size key for the given identity hash, whose length depends on the appender.
+func antispamKey(identity []byte) [32]byte {
+	return sha256.Sum256(identity)
+}
+
+type fsAntispamFollower struct {
+	a      *FSAntispam
+	hasher func([]byte) ([][]byte, error)
+}
+
+func (f *fsAntispamFollower) Name() string {
+	return "FS antispam"
+}
+
+// Follow adds newly integrated entries to the index every poll period until the given context is done. Errors are
+// retried at the next poll.
+func (f *fsAntispamFollower) Follow(ctx context.Context, lr tessera.LogReader) {
+	t := time.NewTicker(f.a.pollPeriod)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		_ = f.follow(ctx, lr)
+	}
+}
+
+func (f *fsAntispamFollower) EntriesProcessed(context.Context) (uint64, error) {
+	f.a.mu.RLock()
+	defer f.a.mu.RUnlock()
+
+	return f.a.next, nil
+}
+
+// follow adds the entries integrated since the last call to the index, one entry bundle at a time.
+func (f *fsAntispamFollower) follow(ctx context.Context, lr tessera.LogReader) error {
+	size, err := lr.IntegratedSize(ctx)
+	if errors.Is(err, os.ErrNotExist) {
+		// The log has not been integrated yet.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	next, _ := f.EntriesProcessed(ctx)
+	if next >= size {
+		return nil
+	}
+
+	getSize := func(context.Context) (uint64, error) { return size, nil }
+	keys := make([][32]byte, 0, layout.EntryBundleWidth)
+	for e, err := range client.Entries(client.EntryBundles(ctx, 1, getSize, lr.ReadEntryBundle, next, size-next), f.hasher) {
+		if err != nil {
+			return err
+		}
+		if want := next + uint64(len(keys)); e.Index != want {
+			return fmt.Errorf("storage: antispam followed entry %d, want %d", e.Index, want)
+		}
+
+		keys = append(keys, antispamKey(e.Entry))
+		if len(keys) == cap(keys) {
+			if err := f.a.write(keys); err != nil {
+				return err
+			}
+			next += uint64(len(keys))
+			keys = keys[:0]
+		}
+	}
+
+	return f.a.write(keys)
+}
+
+var _ tessera.Antispam = (*FSAntispam)(nil)
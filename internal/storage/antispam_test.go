@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/tessera"
+	"github.com/transparency-dev/tessera/storage/posix"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestFSAntispam(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	signer, _ := newTestNoteKey(t, "KeyDonkey")
+	dir := filepath.Join(t.TempDir(), "log")
+
+	ctx, cancel := context.WithCancel(t.Context())
+	as, log, shutdown := newTestAntispamLog(t, ctx, root, dir, signer)
+
+	for i, want := range []uint64{0, 1, 0, 1} {
+		index, err := log.Add(t.Context(), []byte{byte(i % 2)}, []byte("commitment"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index != want {
+			t.Errorf("entry %d was added at index %d, want %d", i, index, want)
+		}
+	}
+
+	// Wait for the entries to be followed, then restart the log.
+	waitForAntispam(t, as, 2)
+	if err := shutdown(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := as.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A partially-written record is discarded.
+	f, err := root.OpenFile("antispam/index", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("torn")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	as, log, shutdown = newTestAntispamLog(t, t.Context(), root, dir, signer)
+	t.Cleanup(func() {
+		_ = shutdown(t.Context())
+		_ = as.Close()
+	})
+
+	// The entries added before the restart resolve to their original indices.
+	for i, want := range []uint64{0, 1, 2} {
+		index, err := log.Add(t.Context(), []byte{byte(i)}, []byte("commitment"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index != want {
+			t.Errorf("entry %d was added at index %d, want %d", i, index, want)
+		}
+	}
+	waitForAntispam(t, as, 3)
+}
+
+func newTestAntispamLog(t *testing.T, ctx context.Context, root *os.Root, dir string, signer note.Signer) (*FSAntispam, LogStore, func(context.Context) error) {
+	t.Helper()
+
+	as, err := NewFSAntispam(root, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	driver, err := posix.New(ctx, posix.Config{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appender, shutdown, reader, err := tessera.NewAppender(ctx, driver, tessera.NewAppendOptions().
+		WithCheckpointSigner(signer).
+		WithCheckpointInterval(100*time.Millisecond).
+		WithBatching(10, 10*time.Millisecond).
+		WithAntispam(tessera.DefaultAntispamInMemorySize, as))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return as, NewTesseraLog(appender, reader, nil), shutdown
+}
+
+func waitForAntispam(t *testing.T, as *FSAntispam, n uint64) {
+	t.Helper()
+
+	f := as.Follower(nil)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		processed, err := f.EntriesProcessed(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if processed == n {
+			return
+		}
+		if processed > n || time.Now().After(deadline) {
+			t.Fatalf("antispam processed %d entries, want %d", processed, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"sync"
+
+	"filippo.io/torchwood/prefix"
+)
+
+// CachingNodeStore is a NodeStore which keeps the most recently used nodes of an underlying NodeStore in a bounded LRU
+// cache. Stores are written through to the underlying NodeStore before the cache is updated.
+type CachingNodeStore struct {
+	inner NodeStore
+	size  int
+
+	mu      sync.Mutex
+	entries map[prefix.Label]*list.Element
+	lru     *list.List
+	hits    uint64
+	misses  uint64
+
+	// stores counts the calls to Store, so that Load can tell whether a node it loaded may have been replaced while it
+	// was loading.
+	stores uint64
+}
+
+// CacheStats records the number of cache hits and misses of a CachingNodeStore.
+type CacheStats struct {
+	Hits, Misses uint64
+	Len          int
+}
+
+// NewCachingNodeStore returns a CachingNodeStore which caches up to size nodes from the given NodeStore. It will panic
+// if size is not positive.
+func NewCachingNodeStore(inner NodeStore, size int) *CachingNodeStore {
+	if size <= 0 {
+		panic("storage: cache size must be positive")
+	}
+
+	return &CachingNodeStore{
+		inner:   inner,
+		size:    size,
+		entries: make(map[prefix.Label]*list.Element, size),
+		lru:     list.New(),
+	}
+}
+
+func (s *CachingNodeStore) Load(ctx context.Context, label prefix.Label) (*prefix.Node, error) {
+	s.mu.Lock()
+	if e, ok := s.entries[label]; ok {
+		s.lru.MoveToFront(e)
+		s.hits++
+		node := *e.Value.(*prefix.Node)
+		s.mu.Unlock()
+		return &node, nil
+	}
+	s.misses++
+	stores := s.stores
+	s.mu.Unlock()
+
+	node, err := s.inner.Load(ctx, label)
+	if err != nil {
+		return nil, err
+	}
+
+	// If a Store ran during the load, the loaded node may be older than the stored one, so it isn't cached.
+	s.mu.Lock()
+	if s.stores == stores {
+		s.add(node)
+	}
+	s.mu.Unlock()
+
+	return node, nil
+}
+
+func (s *CachingNodeStore) Store(ctx context.Context, nodes ...*prefix.Node) error {
+	if err := s.inner.Store(ctx, nodes...); err != nil {
+		// The underlying store may have been partially updated, so drop any cached copies of the nodes.
+		s.mu.Lock()
+		s.stores++
+		for _, node := range nodes {
+			s.remove(node.Label)
+		}
+		s.mu.Unlock()
+		return err
+	}
+
+	s.mu.Lock()
+	s.stores++
+	for _, node := range nodes {
+		s.add(node)
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Stats returns the cache's hit and miss counts and its current length.
+func (s *CachingNodeStore) Stats() CacheStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return CacheStats{Hits: s.hits, Misses: s.misses, Len: s.lru.Len()}
+}
+
+// Close closes the underlying NodeStore, if it implements io.Closer.
+func (s *CachingNodeStore) Close() error {
+	if c, ok := s.inner.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// add inserts a copy of the given node at the front of the cache, evicting the least recently used node if the cache is
+// full. The caller must hold s.mu.
+func (s *CachingNodeStore) add(node *prefix.Node) {
+	n := *node
+	if e, ok := s.entries[n.Label]; ok {
+		e.Value = &n
+		s.lru.MoveToFront(e)
+		return
+	}
+
+	s.entries[n.Label] = s.lru.PushFront(&n)
+	if s.lru.Len() > s.size {
+		s.remove(s.lru.Back().Value.(*prefix.Node).Label)
+	}
+}
+
+// remove drops the node with the given label from the cache. The caller must hold s.mu.
+func (s *CachingNodeStore) remove(label prefix.Label) {
+	if e, ok := s.entries[label]; ok {
+		s.lru.Remove(e)
+		delete(s.entries, label)
+	}
+}
+
+var _ NodeStore = (*CachingNodeStore)(nil)
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"testing"
+
+	"filippo.io/torchwood/prefix"
+)
+
+func TestCachingNodeStore(t *testing.T) {
+	cache := NewCachingNodeStore(prefix.NewMemoryStorage(), 4)
+	if err := prefix.InitStorage(t.Context(), sha256.Sum256, cache); err != nil {
+		t.Fatal(err)
+	}
+
+	tree := prefix.NewTree(sha256.Sum256, cache)
+	for i := range 16 {
+		if err := tree.Insert(t.Context(), sha256.Sum256([]byte{byte(i)}), [32]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := cache.Stats().Len, 4; got != want {
+		t.Errorf("Len = %d, want %d", got, want)
+	}
+
+	before := cache.Stats()
+	var wg sync.WaitGroup
+	for i := range 16 {
+		wg.Go(func() {
+			found, proof, err := tree.Lookup(t.Context(), sha256.Sum256([]byte{byte(i)}))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !found {
+				t.Errorf("label %d not found", i)
+			}
+
+			root, err := tree.RootHash(t.Context())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := prefix.VerifyMembershipProof(sha256.Sum256, sha256.Sum256([]byte{byte(i)}), [32]byte{byte(i)}, proof, root); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	after := cache.Stats()
+	if after.Hits <= before.Hits {
+		t.Errorf("Hits = %d, want more than %d", after.Hits, before.Hits)
+	}
+	if after.Misses <= before.Misses {
+		t.Errorf("Misses = %d, want more than %d", after.Misses, before.Misses)
+	}
+}
+
+func TestCachingNodeStoreConcurrentStore(t *testing.T) {
+	label, err := prefix.NewLabel(8, []byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inner := &blockingNodeStore{NodeStore: prefix.NewMemoryStorage()}
+	if err := inner.Store(t.Context(), &prefix.Node{Label: label, Hash: [32]byte{1}}); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewCachingNodeStore(inner, 4)
+
+	// Store a new version of the node while a load of the old version is in progress.
+	inner.loaded, inner.release = make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := cache.Load(t.Context(), label)
+		done <- err
+	}()
+	<-inner.loaded
+	if err := cache.Store(t.Context(), &prefix.Node{Label: label, Hash: [32]byte{2}}); err != nil {
+		t.Fatal(err)
+	}
+	close(inner.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := cache.Load(t.Context(), label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := node.Hash, [32]byte{2}; got != want {
+		t.Errorf("Hash = %x, want %x", got, want)
+	}
+}
+
+// blockingNodeStore is a NodeStore whose loads wait to be released once loaded is set.
+type blockingNodeStore struct {
+	NodeStore
+	loaded, release chan struct{}
+}
+
+func (s *blockingNodeStore) Load(ctx context.Context, label prefix.Label) (*prefix.Node, error) {
+	node, err := s.NodeStore.Load(ctx, label)
+	if s.loaded != nil {
+		close(s.loaded)
+		<-s.release
+	}
+	return node, err
+}
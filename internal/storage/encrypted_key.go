@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// StorageKey is a secret used to encrypt key records at rest. Each StorageKey has a unique ID, which is recorded with
+// every record it encrypts.
+type StorageKey struct {
+	ID     uint32
+	Secret []byte
+}
+
+// EncryptedKeyStore is a KeyStore which encrypts every record it passes to an underlying KeyStore. Each public key is
+// sealed with AES-256-GCM using a key derived from a StorageKey, and the ciphertext is bound to the record's ID and
+// version. IDs are replaced by pseudonyms derived with HMAC from a separate index secret, so the underlying KeyStore
+// stores neither IDs nor public keys in plaintext.
+type EncryptedKeyStore struct {
+	inner    KeyStore
+	indexKey []byte
+	current  uint32
+	aeads    map[uint32]cipher.AEAD
+
+	// mu prevents Rotate from re-encrypting a record which is being written or erased.
+	mu sync.Mutex
+}
+
+// ErrUnsupported is returned by a store decorator when the underlying store does not support an operation.
+var ErrUnsupported = errors.New("storage: operation not supported by underlying store")
+
+// NewEncryptedKeyStore returns an EncryptedKeyStore which stores records in the given KeyStore. New records are
+// encrypted with the current StorageKey; records encrypted with any of the previous StorageKeys can still be read until
+// Rotate has re-encrypted them. The index secret must not change for the life of the underlying KeyStore.
+func NewEncryptedKeyStore(inner KeyStore, indexSecret []byte, current StorageKey, previous ...StorageKey) (*EncryptedKeyStore, error) {
+	indexKey, err := hkdf.Key(sha256.New, indexSecret, nil, "keydonkey storage index key", 32)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &EncryptedKeyStore{
+		inner:    inner,
+		indexKey: indexKey,
+		current:  current.ID,
+		aeads:    make(map[uint32]cipher.AEAD, 1+len(previous)),
+	}
+
+	for _, sk := range append([]StorageKey{current}, previous...) {
+		if _, ok := s.aeads[sk.ID]; ok {
+			return nil, fmt.Errorf("storage: duplicate storage key ID %d", sk.ID)
+		}
+
+		key, err := hkdf.Key(sha256.New, sk.Secret, nil, "keydonkey storage encryption key", 32)
+		if err != nil {
+			return nil, err
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		s.aeads[sk.ID] = aead
+	}
+
+	return s, nil
+}
+
+func (s *EncryptedKeyStore) Get(ctx context.Context, id string, minVersion uint64) (found bool, pk []byte, version uint64, err error) {
+	pseudonym := s.pseudonym(id)
+
+	found, sealed, version, err := s.inner.Get(ctx, pseudonym, minVersion)
+	if err != nil || !found {
+		return false, nil, 0, err
+	}
+
+	pk, _, err = s.open(pseudonym, version, sealed)
+	if err != nil {
+		return false, nil, 0, err
+	}
+
+	return true, pk, version, nil
+}
+
+func (s *EncryptedKeyStore) Put(ctx context.Context, id string, pk []byte, version uint64) error {
+	pseudonym := s.pseudonym(id)
+	sealed := s.seal(pseudonym, version, pk)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.inner.Put(ctx, pseudonym, sealed, version)
+}
+
+func (s *EncryptedKeyStore) Versions(ctx context.Context, id string) ([]uint64, error) {
+	lister, ok := s.inner.(VersionLister)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return lister.Versions(ctx, s.pseudonym(id))
+}
+
+func (s *EncryptedKeyStore) GetVersion(ctx context.Context, id string, version uint64) (found bool, pk []byte, err error) {
+	lister, ok := s.inner.(VersionLister)
+	if !ok {
+		return false, nil, ErrUnsupported
+	}
+
+	pseudonym := s.pseudonym(id)
+	found, sealed, err := lister.GetVersion(ctx, pseudonym, version)
+	if err != nil || !found {
+		return false, nil, err
+	}
+
+	pk, _, err = s.open(pseudonym, version, sealed)
+	if err != nil {
+		return false, nil, err
+	}
+
+	return true, pk, nil
+}
+
+func (s *EncryptedKeyStore) Erase(ctx context.Context, id string, version uint64, pseudonym, commitment []byte) error {
+	eraser, ok := s.inner.(Eraser)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return eraser.Erase(ctx, s.pseudonym(id), version, pseudonym, commitment)
+}
+
+func (s *EncryptedKeyStore) Tombstones(ctx context.Context, pseudonym []byte) ([]Tombstone, error) {
+	eraser, ok := s.inner.(Eraser)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return eraser.Tombstones(ctx, pseudonym)
+}
+
+// Rotate re-encrypts every record which was not encrypted with the current StorageKey, returning the number of records
+// re-encrypted. It may run in the background while the store is in use. Once it has completed, the previous
+// StorageKeys are no longer needed. The underlying KeyStore must implement IDLister and VersionLister.
+func (s *EncryptedKeyStore) Rotate(ctx context.Context) (n int, err error) {
+	ids, ok := s.inner.(IDLister)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+	lister, ok := s.inner.(VersionLister)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+
+	for pseudonym, err := range ids.IDs(ctx) {
+		if err != nil {
+			return n, err
+		}
+
+		versions, err := lister.Versions(ctx, pseudonym)
+		if err != nil {
+			return n, err
+		}
+
+		for _, version := range versions {
+			rotated, err := s.rotate(ctx, lister, pseudonym, version)
+			if err != nil {
+				return n, err
+			}
+			if rotated {
+				n++
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// rotate re-encrypts the record with the given pseudonym and version if it was not encrypted with the current
+// StorageKey.
+func (s *EncryptedKeyStore) rotate(ctx context.Context, lister VersionLister, pseudonym string, version uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found, sealed, err := lister.GetVersion(ctx, pseudonym, version)
+	if err != nil || !found {
+		return false, err
+	}
+
+	pk, keyID, err := s.open(pseudonym, version, sealed)
+	if err != nil {
+		return false, err
+	}
+	if keyID == s.current {
+		return false, nil
+	}
+
+	return true, s.inner.Put(ctx, pseudonym, s.seal(pseudonym, version, pk), version)
+}
+
+// pseudonym returns the ID under which records for the given ID are stored in the underlying KeyStore.
+func (s *EncryptedKeyStore) pseudonym(id string) string {
+	h := hmac.New(sha256.New, s.indexKey)
+	h.Write([]byte(id))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// seal encrypts the given public key with the current StorageKey. A sealed record consists of the 4-byte big-endian
+// ID of the StorageKey, a random nonce, and the ciphertext.
+func (s *EncryptedKeyStore) seal(pseudonym string, version uint64, pk []byte) []byte {
+	aead := s.aeads[s.current]
+
+	b := binary.BigEndian.AppendUint32(nil, s.current)
+	b = append(b, make([]byte, aead.NonceSize())...)
+	nonce := b[4:]
+	_, _ = rand.Read(nonce)
+
+	return aead.Seal(b, nonce, pk, sealedData(pseudonym, version))
+}
+
+// open decrypts the given sealed record, returning the public key and the ID of the StorageKey which encrypted it.
+func (s *EncryptedKeyStore) open(pseudonym string, version uint64, sealed []byte) (pk []byte, keyID uint32, err error) {
+	if len(sealed) < 4 {
+		return nil, 0, errors.New("storage: malformed sealed key")
+	}
+
+	keyID = binary.BigEndian.Uint32(sealed)
+	aead, ok := s.aeads[keyID]
+	if !ok {
+		return nil, 0, fmt.Errorf("storage: unknown storage key ID %d", keyID)
+	}
+
+	if len(sealed) < 4+aead.NonceSize() {
+		return nil, 0, errors.New("storage: malformed sealed key")
+	}
+	nonce, ciphertext := sealed[4:4+aead.NonceSize()], sealed[4+aead.NonceSize():]
+
+	pk, err = aead.Open(nil, nonce, ciphertext, sealedData(pseudonym, version))
+	if err != nil {
+		return nil, 0, fmt.Errorf("storage: opening sealed key: %w", err)
+	}
+
+	return pk, keyID, nil
+}
+
+// sealedData returns the additional data which binds a sealed record to its ID and version.
+func sealedData(pseudonym string, version uint64) []byte {
+	b := []byte("keydonkey sealed key\x00")
+	b = append(b, pseudonym...)
+	return binary.BigEndian.AppendUint64(b, version)
+}
+
+var (
+	_ KeyStore      = (*EncryptedKeyStore)(nil)
+	_ VersionLister = (*EncryptedKeyStore)(nil)
+	_ Eraser        = (*EncryptedKeyStore)(nil)
+)
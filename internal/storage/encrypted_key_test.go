@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/fs"
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestEncryptedKeyStore(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	inner, err := NewFSKeyStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = inner.Close() })
+
+	indexSecret, oldKey, newKey := []byte("index secret"), StorageKey{ID: 1, Secret: []byte("old")}, StorageKey{ID: 2, Secret: []byte("new")}
+
+	keys, err := NewEncryptedKeyStore(inner, indexSecret, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pk, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Put(t.Context(), "dingus@example.com", pk, 22); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the ID nor the public key are stored in plaintext.
+	if err := fs.WalkDir(root.FS(), "keys", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := root.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(b, []byte("dingus")) || bytes.Contains(b, pk) {
+			t.Errorf("%s contains plaintext: %s", path, b)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	found, got, version, err := keys.Get(t.Context(), "dingus@example.com", 20)
+	if err != nil || !found || !bytes.Equal(got, pk) || version != 22 {
+		t.Fatalf("Get() = %v, %x, %d, %v, want true, %x, 22, nil", found, got, version, err, pk)
+	}
+
+	// Records are bound to their version.
+	_, sealed, err := inner.GetVersion(t.Context(), keys.pseudonym("dingus@example.com"), 22)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inner.Put(t.Context(), keys.pseudonym("dingus@example.com"), sealed, 23); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := keys.GetVersion(t.Context(), "dingus@example.com", 23); err == nil {
+		t.Error("GetVersion() succeeded for a record moved to another version")
+	}
+
+	keys, err = NewEncryptedKeyStore(inner, indexSecret, newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, got, err := keys.GetVersion(t.Context(), "dingus@example.com", 22); err != nil || !found || !bytes.Equal(got, pk) {
+		t.Fatalf("GetVersion() = %v, %x, %v before rotation", found, got, err)
+	}
+
+	// Version 23 can't be opened, so rotate just version 22.
+	if rotated, err := keys.rotate(t.Context(), inner, keys.pseudonym("dingus@example.com"), 22); err != nil || !rotated {
+		t.Fatalf("rotate() = %v, %v", rotated, err)
+	}
+
+	keys, err = NewEncryptedKeyStore(inner, indexSecret, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, got, err := keys.GetVersion(t.Context(), "dingus@example.com", 22); err != nil || !found || !bytes.Equal(got, pk) {
+		t.Fatalf("GetVersion() = %v, %x, %v after rotation", found, got, err)
+	}
+}
+
+func TestEncryptedKeyStoreRotate(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	fsKeys, err := NewFSKeyStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = fsKeys.Close() })
+
+	// Rotation works through an instrumented store.
+	inner, err := NewInstrumentedKeyStore(fsKeys, noop.NewMeterProvider())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexSecret, oldKey, newKey := []byte("index secret"), StorageKey{ID: 1, Secret: []byte("old")}, StorageKey{ID: 2, Secret: []byte("new")}
+
+	keys, err := NewEncryptedKeyStore(inner, indexSecret, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		for version := range uint64(2) {
+			if err := keys.Put(t.Context(), id, []byte(id), version); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := keys.Erase(t.Context(), "c", 0, []byte("pseudonym"), []byte("commitment")); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err = NewEncryptedKeyStore(inner, indexSecret, newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := keys.Rotate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, 5; got != want {
+		t.Errorf("Rotate() = %d, want %d", got, want)
+	}
+	if n, err := keys.Rotate(t.Context()); err != nil || n != 0 {
+		t.Errorf("Rotate() = %d, %v, want 0", n, err)
+	}
+
+	keys, err = NewEncryptedKeyStore(inner, indexSecret, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		found, pk, version, err := keys.Get(t.Context(), id, 0)
+		if err != nil || !found || string(pk) != id || version != 1 {
+			t.Errorf("Get(%q) = %v, %q, %d, %v", id, found, pk, version, err)
+		}
+	}
+}
@@ -8,8 +8,12 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"iter"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 type FSKeyStore struct {
@@ -43,20 +47,44 @@ func (s *FSKeyStore) Get(_ context.Context, id string, minVersion uint64) (found
 		}
 	}
 
-	b, err := s.root.ReadFile(filename)
+	key, err := s.read(filename)
+	if err != nil || key == nil {
+		return false, nil, 0, err
+	}
+
+	return true, key.PK, key.Version, nil
+}
+
+func (s *FSKeyStore) Versions(_ context.Context, id string) ([]uint64, error) {
+	_, glob, _ := keyPathGlobAndFilename(id, 0)
+
+	matches, err := fs.Glob(s.root.FS(), glob)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return false, nil, 0, nil
+		return nil, err
+	}
+
+	versions := make([]uint64, 0, len(matches))
+	for _, match := range matches {
+		version, err := keyVersion(filepath.Base(match))
+		if err != nil {
+			return nil, err
 		}
-		return false, nil, 0, err
+		versions = append(versions, version)
 	}
+	slices.Sort(versions)
 
-	var key keyData
-	if err := json.Unmarshal(b, &key); err != nil {
-		return false, nil, 0, err
+	return versions, nil
+}
+
+func (s *FSKeyStore) GetVersion(_ context.Context, id string, version uint64) (found bool, pk []byte, err error) {
+	_, _, filename := keyPathGlobAndFilename(id, version)
+
+	key, err := s.read(filename)
+	if err != nil || key == nil {
+		return false, nil, err
 	}
 
-	return true, key.PK, key.Version, nil
+	return true, key.PK, nil
 }
 
 func (s *FSKeyStore) Put(_ context.Context, id string, pk []byte, version uint64) error {
@@ -79,16 +107,128 @@ func (s *FSKeyStore) Put(_ context.Context, id string, pk []byte, version uint64
 	return nil
 }
 
+// Erase writes a tombstone for the given version to a file named after the pseudonym, then removes the key file. If
+// it fails between the two, the key remains readable until Erase is retried.
+func (s *FSKeyStore) Erase(_ context.Context, id string, version uint64, pseudonym, commitment []byte) error {
+	b, err := json.Marshal(&Tombstone{Version: version, Commitment: commitment})
+	if err != nil {
+		return err
+	}
+
+	path, _, tombstone := tombstonePathGlobAndFilename(pseudonym, version)
+	if err := s.root.MkdirAll(path, 0777); err != nil {
+		return err
+	}
+	if err := s.root.WriteFile(tombstone, b, 0666); err != nil {
+		return err
+	}
+
+	_, _, filename := keyPathGlobAndFilename(id, version)
+	if err := s.root.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *FSKeyStore) Tombstones(_ context.Context, pseudonym []byte) ([]Tombstone, error) {
+	_, glob, _ := tombstonePathGlobAndFilename(pseudonym, 0)
+
+	matches, err := fs.Glob(s.root.FS(), glob)
+	if err != nil {
+		return nil, err
+	}
+
+	// Versions are zero-padded, so the matches are sorted by version.
+	tombstones := make([]Tombstone, 0, len(matches))
+	for _, match := range matches {
+		b, err := s.root.ReadFile(match)
+		if err != nil {
+			return nil, err
+		}
+
+		var t Tombstone
+		if err := json.Unmarshal(b, &t); err != nil {
+			return nil, err
+		}
+		tombstones = append(tombstones, t)
+	}
+
+	return tombstones, nil
+}
+
+func (s *FSKeyStore) IDs(_ context.Context) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		// Key files are named after a hash of their ID, so they must be read to recover it. WalkDir visits files in
+		// lexical order, so all the versions of an ID are adjacent.
+		var last string
+		err := fs.WalkDir(s.root.FS(), ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && path == erasedDir {
+				return fs.SkipDir
+			}
+			if d.IsDir() || !strings.HasSuffix(path, ".json") {
+				return nil
+			}
+
+			hexLabel, _, _ := strings.Cut(filepath.Base(path), "-")
+			if hexLabel == last {
+				return nil
+			}
+
+			key, err := s.read(path)
+			if err != nil {
+				return err
+			}
+			if key == nil {
+				return nil
+			}
+
+			last = hexLabel
+			if !yield(key.ID, nil) {
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			yield("", err)
+		}
+	}
+}
+
 func (s *FSKeyStore) Close() error {
 	return s.root.Close()
 }
 
+// read returns the key record stored in the given file, or nil if the file does not exist.
+func (s *FSKeyStore) read(filename string) (*keyData, error) {
+	b, err := s.root.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var key keyData
+	if err := json.Unmarshal(b, &key); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
 type keyData struct {
 	ID      string
 	PK      []byte
 	Version uint64
 }
 
+// erasedDir is the directory in which tombstones are stored.
+const erasedDir = "erased"
+
 func keyPathGlobAndFilename(id string, version uint64) (path, glob, filename string) {
 	hash := sha256.Sum256([]byte(id))
 	hexLabel := hex.EncodeToString(hash[:])
@@ -98,4 +238,26 @@ func keyPathGlobAndFilename(id string, version uint64) (path, glob, filename str
 	return path, glob, filename
 }
 
-var _ KeyStore = (*FSKeyStore)(nil)
+func tombstonePathGlobAndFilename(pseudonym []byte, version uint64) (path, glob, filename string) {
+	hexPseudonym := hex.EncodeToString(pseudonym)
+	path = filepath.Join(erasedDir, hexPseudonym[:2], hexPseudonym[2:4])
+	glob = filepath.Join(path, fmt.Sprintf("%s-*.json", hexPseudonym))
+	filename = filepath.Join(path, fmt.Sprintf("%s-%016x.json", hexPseudonym, version))
+	return path, glob, filename
+}
+
+// keyVersion parses the version from the base name of a key file.
+func keyVersion(name string) (uint64, error) {
+	_, hexVersion, ok := strings.Cut(strings.TrimSuffix(name, ".json"), "-")
+	if !ok {
+		return 0, fmt.Errorf("storage: malformed key filename %q", name)
+	}
+	return strconv.ParseUint(hexVersion, 16, 64)
+}
+
+var (
+	_ KeyStore      = (*FSKeyStore)(nil)
+	_ VersionLister = (*FSKeyStore)(nil)
+	_ IDLister      = (*FSKeyStore)(nil)
+	_ Eraser        = (*FSKeyStore)(nil)
+)
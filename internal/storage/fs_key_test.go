@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestFSKeyStoreGetVersion(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	keys, err := NewFSKeyStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = keys.Close() })
+
+	for version := range uint64(2) {
+		if err := keys.Put(t.Context(), "dingus", []byte{byte(version)}, version); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, pk, err := keys.GetVersion(t.Context(), "dingus", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || !bytes.Equal(pk, []byte{1}) {
+		t.Errorf("GetVersion(1) = %v, %x, want found with %x", found, pk, []byte{1})
+	}
+
+	if found, _, err := keys.GetVersion(t.Context(), "dingus", 2); err != nil || found {
+		t.Errorf("GetVersion(2) = %v, %v, want not found", found, err)
+	}
+
+	// Erased versions are no longer found, but the other versions are.
+	if err := keys.Erase(t.Context(), "dingus", 0, []byte("pseudonym"), []byte("commitment")); err != nil {
+		t.Fatal(err)
+	}
+	if found, _, err := keys.GetVersion(t.Context(), "dingus", 0); err != nil || found {
+		t.Errorf("GetVersion(0) = %v, %v, want not found", found, err)
+	}
+	if found, _, err := keys.GetVersion(t.Context(), "dingus", 1); err != nil || !found {
+		t.Errorf("GetVersion(1) = %v, %v, want found", found, err)
+	}
+}
+
+func TestFSKeyStoreErase(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	keys, err := NewFSKeyStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = keys.Close() })
+
+	for _, id := range []string{"a", "b"} {
+		for version := range uint64(2) {
+			if err := keys.Put(t.Context(), id, []byte(id), version); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	pseudonym := []byte("pseudonym")
+	for version := range uint64(2) {
+		if err := keys.Erase(t.Context(), "a", version, pseudonym, []byte{byte(version)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Erased keys are removed.
+	if found, _, _, err := keys.Get(t.Context(), "a", 0); err != nil || found {
+		t.Errorf("Get() = %v, %v, want not found", found, err)
+	}
+	if versions, err := keys.Versions(t.Context(), "a"); err != nil || len(versions) != 0 {
+		t.Errorf("Versions() = %v, %v, want none", versions, err)
+	}
+
+	var ids []string
+	for id, err := range keys.IDs(t.Context()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if want := []string{"b"}; !slices.Equal(ids, want) {
+		t.Errorf("IDs() = %v, want %v", ids, want)
+	}
+
+	// Their tombstones are found by pseudonym.
+	tombstones, err := keys.Tombstones(t.Context(), pseudonym)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(tombstones), 2; got != want {
+		t.Fatalf("len(Tombstones()) = %d, want %d", got, want)
+	}
+	for i, ts := range tombstones {
+		if ts.Version != uint64(i) || !slices.Equal(ts.Commitment, []byte{byte(i)}) {
+			t.Errorf("Tombstones()[%d] = %+v, want version %d", i, ts, i)
+		}
+	}
+
+	if tombstones, err := keys.Tombstones(t.Context(), []byte("something else")); err != nil || len(tombstones) != 0 {
+		t.Errorf("Tombstones() = %v, %v, want none", tombstones, err)
+	}
+}
@@ -2,17 +2,24 @@ package storage
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"filippo.io/torchwood/prefix"
 )
 
+// FSNodeStore stores each node of a prefix tree as a file in a directory tree. Nodes are written in a compact binary
+// encoding; nodes written by earlier versions as JSON are still read until MigrateFSNodeStore has rewritten them.
 type FSNodeStore struct {
-	root *os.Root
+	root   *os.Root
+	legacy bool
 }
 
 func NewFSNodeStore(root *os.Root) (*FSNodeStore, error) {
@@ -24,13 +31,25 @@ func NewFSNodeStore(root *os.Root) (*FSNodeStore, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &FSNodeStore{root: root}, nil
+
+	// The legacy root node is removed last during migration, so its presence means legacy nodes may remain.
+	legacy := true
+	if _, err := root.Stat(legacyRootFilename); errors.Is(err, os.ErrNotExist) {
+		legacy = false
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &FSNodeStore{root: root, legacy: legacy}, nil
 }
 
 func (s *FSNodeStore) Load(_ context.Context, label prefix.Label) (*prefix.Node, error) {
 	_, filename := nodePathAndFilename(label)
 
 	b, err := s.root.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) && s.legacy {
+		return s.loadLegacy(label)
+	}
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil, prefix.ErrNodeNotFound
@@ -41,6 +60,28 @@ func (s *FSNodeStore) Load(_ context.Context, label prefix.Label) (*prefix.Node,
 	return bytesToNode(b)
 }
 
+// loadLegacy loads the node with the given label from its legacy JSON file. Legacy filenames omit the label's bit
+// length, so the file may hold a different node with the same label bytes.
+func (s *FSNodeStore) loadLegacy(label prefix.Label) (*prefix.Node, error) {
+	b, err := s.root.ReadFile(legacyFilename(label))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, prefix.ErrNodeNotFound
+		}
+		return nil, err
+	}
+
+	node, err := bytesToNode(b)
+	if err != nil {
+		return nil, err
+	}
+	if node.Label != label {
+		return nil, prefix.ErrNodeNotFound
+	}
+
+	return node, nil
+}
+
 func (s *FSNodeStore) Store(_ context.Context, nodes ...*prefix.Node) error {
 	for _, node := range nodes {
 		b := nodeToBytes(node)
@@ -56,47 +97,220 @@ func (s *FSNodeStore) Store(_ context.Context, nodes ...*prefix.Node) error {
 		if err := s.root.WriteFile(filename, b, 0666); err != nil {
 			return err
 		}
+
+		// Remove any legacy copy of the node, which is now stale.
+		if s.legacy {
+			if err := s.removeLegacy(node.Label); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
+// removeLegacy removes the legacy JSON file of the node with the given label, unless the file holds a different node
+// with the same label bytes.
+func (s *FSNodeStore) removeLegacy(label prefix.Label) error {
+	if _, err := s.loadLegacy(label); errors.Is(err, prefix.ErrNodeNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.root.Remove(legacyFilename(label)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
 func (s *FSNodeStore) Close() error {
 	return s.root.Close()
 }
 
+// MigrateFSNodeStore rewrites every legacy JSON node in the "nodes" directory of the given root in the binary
+// encoding, returning the number of nodes migrated. Legacy nodes which already have a binary counterpart are removed
+// without being rewritten. It must not be run while the directory is in use. If it is interrupted, it can safely be run
+// again.
+func MigrateFSNodeStore(root *os.Root) (n int, err error) {
+	root, err = root.OpenRoot("nodes")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if closeErr := root.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	var filenames []string
+	if err := fs.WalkDir(root.FS(), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, legacyExt) && path != legacyRootFilename {
+			filenames = append(filenames, path)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	// Migrate the root node last, as its presence marks the directory as containing legacy nodes.
+	if _, err := root.Stat(legacyRootFilename); err == nil {
+		filenames = append(filenames, legacyRootFilename)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	for _, filename := range filenames {
+		b, err := root.ReadFile(filename)
+		if err != nil {
+			return n, err
+		}
+
+		node, err := bytesToNode(b)
+		if err != nil {
+			return n, fmt.Errorf("storage: %s: %w", filename, err)
+		}
+
+		path, newFilename := nodePathAndFilename(node.Label)
+		if path != "" {
+			if err := root.MkdirAll(path, 0777); err != nil {
+				return n, err
+			}
+		}
+
+		// A node which has already been rewritten in the binary encoding may since have been updated, so only the legacy
+		// file is removed.
+		if _, err := root.Stat(newFilename); errors.Is(err, os.ErrNotExist) {
+			if err := writeFileAtomic(root, newFilename, nodeToBytes(node)); err != nil {
+				return n, err
+			}
+		} else if err != nil {
+			return n, err
+		}
+
+		if err := root.Remove(filename); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// writeFileAtomic writes the given data to a temporary file, then renames it to the given filename, so that the file
+// is never left partially written.
+func writeFileAtomic(root *os.Root, filename string, b []byte) error {
+	f, err := root.OpenFile(filename+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return root.Rename(filename+".tmp", filename)
+}
+
+// nodePathAndFilename returns the directory and filename of the node with the given label. Unlike legacy filenames,
+// the label's bit length is included, as labels of different lengths may have the same bytes.
 func nodePathAndFilename(label prefix.Label) (path, filename string) {
 	switch label {
 	case prefix.EmptyNodeLabel:
-		return "", "empty.json"
+		return "", "empty" + nodeExt
 	case prefix.RootLabel:
-		return "", "root.json"
+		return "", "root" + nodeExt
 	default:
 		hexLabel := hex.EncodeToString(label.Bytes())
 		path = filepath.Join(hexLabel[:2], hexLabel[2:4])
-		filename = filepath.Join(hexLabel[:2], hexLabel[2:4], hexLabel+".json")
+		filename = filepath.Join(hexLabel[:2], hexLabel[2:4], fmt.Sprintf("%s-%03d%s", hexLabel, label.BitLen(), nodeExt))
 		return path, filename
 	}
 }
 
-func nodeToBytes(node *prefix.Node) []byte {
-	data := nodeData{
-		LabelBitLen: node.Label.BitLen(),
-		LabelBytes:  node.Label.Bytes(),
-		LeftBitLen:  node.Left.BitLen(),
-		LeftBytes:   node.Left.Bytes(),
-		RightBitLen: node.Right.BitLen(),
-		RightBytes:  node.Right.Bytes(),
-		Hash:        node.Hash,
-	}
-	b, err := json.Marshal(data)
-	if err != nil {
-		panic(err)
+func legacyFilename(label prefix.Label) string {
+	switch label {
+	case prefix.EmptyNodeLabel:
+		return "empty" + legacyExt
+	case prefix.RootLabel:
+		return legacyRootFilename
+	default:
+		hexLabel := hex.EncodeToString(label.Bytes())
+		return filepath.Join(hexLabel[:2], hexLabel[2:4], hexLabel+legacyExt)
 	}
+}
+
+const (
+	nodeExt            = ".node"
+	legacyExt          = ".json"
+	legacyRootFilename = "root" + legacyExt
+)
+
+// The binary node encoding is a version byte followed by the label, left, and right labels, each encoded as a 4-byte
+// big-endian bit length and 32 bytes, followed by the 32-byte hash.
+const (
+	nodeFormatV1   = 0x01
+	labelSize      = 4 + 32
+	nodeBinarySize = 1 + 3*labelSize + 32
+)
+
+func nodeToBytes(node *prefix.Node) []byte {
+	b := make([]byte, 0, nodeBinarySize)
+	b = append(b, nodeFormatV1)
+	b = appendLabel(b, node.Label)
+	b = appendLabel(b, node.Left)
+	b = appendLabel(b, node.Right)
+	b = append(b, node.Hash[:]...)
 	return b
 }
 
+func appendLabel(b []byte, label prefix.Label) []byte {
+	b = binary.BigEndian.AppendUint32(b, label.BitLen())
+	return append(b, label.Bytes()...)
+}
+
 func bytesToNode(b []byte) (*prefix.Node, error) {
+	if len(b) > 0 && b[0] == '{' {
+		return legacyBytesToNode(b)
+	}
+
+	if len(b) != nodeBinarySize {
+		return nil, fmt.Errorf("storage: invalid node length %d", len(b))
+	}
+	if b[0] != nodeFormatV1 {
+		return nil, fmt.Errorf("storage: unknown node format version %d", b[0])
+	}
+	b = b[1:]
+
+	var labels [3]prefix.Label
+	for i := range labels {
+		label, err := prefix.NewLabel(binary.BigEndian.Uint32(b), b[4:labelSize])
+		if err != nil {
+			return nil, err
+		}
+		labels[i] = label
+		b = b[labelSize:]
+	}
+
+	return &prefix.Node{
+		Label: labels[0],
+		Left:  labels[1],
+		Right: labels[2],
+		Hash:  [32]byte(b),
+	}, nil
+}
+
+func legacyBytesToNode(b []byte) (*prefix.Node, error) {
 	var data nodeData
 	if err := json.Unmarshal(b, &data); err != nil {
 		return nil, err
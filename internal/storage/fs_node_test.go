@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	"filippo.io/torchwood/prefix"
+)
+
+func TestFSNodeStoreMigration(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	// Build a tree, then rewrite every node in the legacy JSON encoding.
+	nodes, err := NewFSNodeStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prefix.InitStorage(t.Context(), sha256.Sum256, nodes); err != nil {
+		t.Fatal(err)
+	}
+	// Use few enough keys that no two internal nodes share a legacy filename.
+	tree := prefix.NewTree(sha256.Sum256, nodes)
+	for i := range 3 {
+		if err := tree.Insert(t.Context(), sha256.Sum256([]byte{byte(i)}), [32]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rootHash, err := tree.RootHash(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, nodes, rootHash, 3)
+	if err := nodes.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	nodesRoot, err := root.OpenRoot("nodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = nodesRoot.Close() }()
+	n := 0
+	for _, filename := range nodeFiles(t, nodesRoot, nodeExt) {
+		b, err := nodesRoot.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		node, err := bytesToNode(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := nodesRoot.WriteFile(legacyFilename(node.Label), legacyNodeToBytes(node), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := nodesRoot.Remove(filename); err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+
+	// Legacy nodes are still readable.
+	nodes, err = NewFSNodeStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, nodes, rootHash, 3)
+	if err := nodes.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := MigrateFSNodeStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := migrated, n; got != want {
+		t.Errorf("MigrateFSNodeStore() = %d, want %d", got, want)
+	}
+	if legacy := nodeFiles(t, nodesRoot, legacyExt); len(legacy) != 0 {
+		t.Errorf("legacy nodes remain after migration: %v", legacy)
+	}
+
+	nodes, err = NewFSNodeStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = nodes.Close() }()
+	if nodes.legacy {
+		t.Error("migrated node store is in legacy mode")
+	}
+	checkTree(t, nodes, rootHash, 3)
+}
+
+func TestFSNodeStoreMigrationExisting(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	nodes, err := NewFSNodeStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	label, err := prefix.NewLabel(256, []byte(strings.Repeat("\x42", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &prefix.Node{Label: label, Hash: [32]byte{2}}
+	if err := nodes.Store(t.Context(), node); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave behind an older legacy copy of the node, as an interrupted migration would.
+	nodesRoot, err := root.OpenRoot("nodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = nodesRoot.Close() }()
+	if err := nodesRoot.MkdirAll("42/42", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodesRoot.WriteFile(legacyFilename(label), legacyNodeToBytes(&prefix.Node{Label: label, Hash: [32]byte{1}}), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := MigrateFSNodeStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := migrated, 1; got != want {
+		t.Errorf("MigrateFSNodeStore() = %d, want %d", got, want)
+	}
+	if legacy := nodeFiles(t, nodesRoot, legacyExt); len(legacy) != 0 {
+		t.Errorf("legacy nodes remain after migration: %v", legacy)
+	}
+
+	nodes, err = NewFSNodeStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = nodes.Close() }()
+	got, err := nodes.Load(t.Context(), label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Hash != node.Hash {
+		t.Errorf("Hash = %x, want %x", got.Hash, node.Hash)
+	}
+}
+
+func TestFSNodeStoreLabelLengths(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	nodes, err := NewFSNodeStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = nodes.Close() })
+
+	// The labels 1 and 10 have the same bytes but different bit lengths.
+	one, err := prefix.NewLabel(1, []byte{0x80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oneZero, err := prefix.NewLabel(2, []byte{0x80})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nodes.Store(t.Context(), &prefix.Node{Label: one, Hash: [32]byte{1}}, &prefix.Node{Label: oneZero, Hash: [32]byte{2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []prefix.Node{{Label: one, Hash: [32]byte{1}}, {Label: oneZero, Hash: [32]byte{2}}} {
+		got, err := nodes.Load(t.Context(), want.Label)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != want {
+			t.Errorf("Load(%s) = %s, want %s", want.Label, got, &want)
+		}
+	}
+}
+
+func TestFSNodeStoreLegacyLabelLengths(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	// The labels 1 and 10 have the same bytes, and so the same legacy filename.
+	one, err := prefix.NewLabel(1, []byte{0x80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oneZero, err := prefix.NewLabel(2, []byte{0x80})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := root.MkdirAll("nodes/80/00", 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range []*prefix.Node{{Label: prefix.RootLabel}, {Label: one, Hash: [32]byte{1}}} {
+		if err := root.WriteFile("nodes/"+legacyFilename(node.Label), legacyNodeToBytes(node), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	nodes, err := NewFSNodeStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = nodes.Close() })
+	if !nodes.legacy {
+		t.Fatal("node store is not in legacy mode")
+	}
+
+	// Storing a node doesn't remove the legacy file of another node with the same label bytes.
+	if err := nodes.Store(t.Context(), &prefix.Node{Label: oneZero, Hash: [32]byte{2}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []prefix.Node{{Label: one, Hash: [32]byte{1}}, {Label: oneZero, Hash: [32]byte{2}}} {
+		got, err := nodes.Load(t.Context(), want.Label)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != want {
+			t.Errorf("Load(%s) = %s, want %s", want.Label, got, &want)
+		}
+	}
+
+	// Storing the node itself does.
+	if err := nodes.Store(t.Context(), &prefix.Node{Label: one, Hash: [32]byte{3}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.Stat("nodes/" + legacyFilename(one)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat() = %v, want ErrNotExist", err)
+	}
+}
+
+func checkTree(t *testing.T, nodes NodeStore, rootHash [32]byte, n int) {
+	t.Helper()
+
+	tree := prefix.NewTree(sha256.Sum256, nodes)
+	if got, err := tree.RootHash(t.Context()); err != nil || got != rootHash {
+		t.Fatalf("RootHash() = %x, %v, want %x", got, err, rootHash)
+	}
+	for i := range n {
+		found, proof, err := tree.Lookup(t.Context(), sha256.Sum256([]byte{byte(i)}))
+		if err != nil || !found {
+			t.Fatalf("Lookup(%d) = %v, %v", i, found, err)
+		}
+		if err := prefix.VerifyMembershipProof(sha256.Sum256, sha256.Sum256([]byte{byte(i)}), [32]byte{byte(i)}, proof, rootHash); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func nodeFiles(t *testing.T, root *os.Root, ext string) []string {
+	t.Helper()
+
+	var filenames []string
+	if err := fs.WalkDir(root.FS(), ".", func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(path, ext) {
+			filenames = append(filenames, path)
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return filenames
+}
+
+func legacyNodeToBytes(node *prefix.Node) []byte {
+	data := nodeData{
+		LabelBitLen: node.Label.BitLen(),
+		LabelBytes:  node.Label.Bytes(),
+		LeftBitLen:  node.Left.BitLen(),
+		LeftBytes:   node.Left.Bytes(),
+		RightBitLen: node.Right.BitLen(),
+		RightBytes:  node.Right.Bytes(),
+		Hash:        node.Hash,
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
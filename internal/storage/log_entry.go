@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Transparency log entries are either key entries, which record the insertion of a label and commitment into the
+// prefix tree, or root entries, which record the root hash of the prefix tree as of an epoch. A key entry is the
+// 32-byte label followed by the 32-byte commitment. A root entry is the tag byte 0x01 followed by the 8-byte
+// big-endian epoch, the 8-byte big-endian timestamp in nanoseconds since the Unix epoch, and the 32-byte root hash.
+// The two are distinguished by length.
+const (
+	KeyEntrySize  = 32 + 32
+	RootEntrySize = 1 + 8 + 8 + 32
+
+	rootEntryTag = 0x01
+)
+
+// LogRoot is the root hash of the prefix tree as of an epoch, as recorded in a root entry.
+type LogRoot struct {
+	Epoch uint64
+	Time  time.Time
+	Hash  [32]byte
+}
+
+// KeyEntry returns the key entry for the given label and commitment.
+func KeyEntry(label, commitment []byte) []byte {
+	return slices.Concat(label, commitment)
+}
+
+// RootEntry returns the root entry for the given root.
+func RootEntry(root LogRoot) []byte {
+	b := make([]byte, 0, RootEntrySize)
+	b = append(b, rootEntryTag)
+	b = binary.BigEndian.AppendUint64(b, root.Epoch)
+	b = binary.BigEndian.AppendUint64(b, uint64(root.Time.UnixNano()))
+	return append(b, root.Hash[:]...)
+}
+
+// ParseRootEntry parses the given root entry.
+func ParseRootEntry(b []byte) (LogRoot, error) {
+	if len(b) != RootEntrySize || b[0] != rootEntryTag {
+		return LogRoot{}, fmt.Errorf("storage: malformed root entry")
+	}
+
+	return LogRoot{
+		Epoch: binary.BigEndian.Uint64(b[1:]),
+		Time:  time.Unix(0, int64(binary.BigEndian.Uint64(b[9:]))),
+		Hash:  [32]byte(b[17:]),
+	}, nil
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/transparency-dev/formats/log"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// algEd25519 identifies Ed25519 keys in note's key encodings.
+const algEd25519 = 1
+
+func NewSigner(name string, privateKey ed25519.PrivateKey) (note.Signer, error) {
+	h := keyHash(name, append([]byte{algEd25519}, privateKey.Public().(ed25519.PublicKey)...))
+	signer, err := note.NewSigner(fmt.Sprintf("PRIVATE+KEY+%s+%08x+%s",
+		name, h, base64.StdEncoding.EncodeToString(append([]byte{algEd25519}, privateKey.Seed()...)),
+	))
+	if err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// NewVerifier returns a verifier for the signatures of the signer returned by NewSigner for the given name and the
+// corresponding private key.
+func NewVerifier(name string, publicKey ed25519.PublicKey) (note.Verifier, error) {
+	vkey, err := EncodeVerifierKey(name, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return note.NewVerifier(vkey)
+}
+
+// EncodeVerifierKey returns the note verifier key, or vkey, for the given name and public key. The vkey is published
+// so that clients and witnesses can verify the log's checkpoints.
+func EncodeVerifierKey(name string, publicKey ed25519.PublicKey) (string, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("storage: invalid public key length %d", len(publicKey))
+	}
+
+	key := append([]byte{algEd25519}, publicKey...)
+	return fmt.Sprintf("%s+%08x+%s", name, keyHash(name, key), base64.StdEncoding.EncodeToString(key)), nil
+}
+
+// DecodeVerifierKey returns the name and public key of the given Ed25519 note verifier key.
+func DecodeVerifierKey(vkey string) (name string, publicKey ed25519.PublicKey, err error) {
+	// Parsing the vkey validates its name and key hash.
+	if _, err := note.NewVerifier(vkey); err != nil {
+		return "", nil, fmt.Errorf("storage: %w", err)
+	}
+
+	name, rest, _ := strings.Cut(vkey, "+")
+	_, key64, _ := strings.Cut(rest, "+")
+	key, err := base64.StdEncoding.DecodeString(key64)
+	if err != nil || len(key) != 1+ed25519.PublicKeySize || key[0] != algEd25519 {
+		return "", nil, errors.New("storage: malformed verifier key")
+	}
+
+	return name, key[1:], nil
+}
+
+// OpenCheckpoint verifies that the given checkpoint is signed by the log's verifier, whose name must be the
+// checkpoint's origin, and parses it.
+func OpenCheckpoint(checkpoint []byte, logVerifier note.Verifier) (*log.Checkpoint, error) {
+	cp, _, _, err := log.ParseCheckpoint(checkpoint, logVerifier.Name(), logVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("storage: %w", err)
+	}
+	return cp, nil
+}
+
+// VerifyCheckpoint verifies that the given checkpoint is signed by the log's verifier, whose name must be the
+// checkpoint's origin, and cosigned by at least threshold of the given witnesses, and parses it.
+func VerifyCheckpoint(checkpoint []byte, logVerifier note.Verifier, threshold int, witnesses ...note.Verifier) (*log.Checkpoint, error) {
+	cp, _, n, err := log.ParseCheckpoint(checkpoint, logVerifier.Name(), logVerifier, witnesses...)
+	if err != nil {
+		return nil, fmt.Errorf("storage: %w", err)
+	}
+
+	cosigned := 0
+	for _, w := range witnesses {
+		if slices.ContainsFunc(n.Sigs, func(sig note.Signature) bool {
+			return sig.Name == w.Name() && sig.Hash == w.KeyHash()
+		}) {
+			cosigned++
+		}
+	}
+	if cosigned < threshold {
+		return nil, fmt.Errorf("storage: checkpoint has %d of %d required witness cosignatures", cosigned, threshold)
+	}
+
+	return cp, nil
+}
+
+func keyHash(name string, key []byte) uint32 {
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte("\n"))
+	h.Write(key)
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint32(sum)
+}
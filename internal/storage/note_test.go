@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/transparency-dev/formats/log"
+	fnote "github.com/transparency-dev/formats/note"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestVerifier(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewSigner("KeyDonkey", privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := NewVerifier("KeyDonkey", publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifier.Name() != signer.Name() || verifier.KeyHash() != signer.KeyHash() {
+		t.Errorf("verifier = %s/%08x, want %s/%08x", verifier.Name(), verifier.KeyHash(), signer.Name(), signer.KeyHash())
+	}
+
+	vkey, err := EncodeVerifierKey("KeyDonkey", publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, decoded, err := DecodeVerifierKey(vkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "KeyDonkey" || !decoded.Equal(publicKey) {
+		t.Errorf("DecodeVerifierKey(%q) = %q, %x, want %q, %x", vkey, name, decoded, "KeyDonkey", publicKey)
+	}
+	if _, _, err := DecodeVerifierKey(vkey[:len(vkey)-4]); err == nil {
+		t.Error("decoded truncated verifier key")
+	}
+
+	// The verifier must open checkpoints signed by the signer.
+	checkpoint, err := note.Sign(&note.Note{Text: string(log.Checkpoint{
+		Origin: "KeyDonkey",
+		Size:   22,
+		Hash:   make([]byte, 32),
+	}.Marshal())}, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cp, err := OpenCheckpoint(checkpoint, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cp.Size, uint64(22); got != want {
+		t.Errorf("Size = %d, want %d", got, want)
+	}
+
+	otherPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewVerifier("KeyDonkey", otherPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenCheckpoint(checkpoint, other); err == nil {
+		t.Error("opened checkpoint with the wrong verifier")
+	}
+
+	// Checkpoints must carry the required number of witness cosignatures.
+	skey, witnessVKey, err := note.GenerateKey(rand.Reader, "Witness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cosigner, err := fnote.NewSignerForCosignatureV1(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	witness, err := NewWitnessVerifier(witnessVKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyCheckpoint(checkpoint, verifier, 0, witness); err != nil {
+		t.Error(err)
+	}
+	if _, err := VerifyCheckpoint(checkpoint, verifier, 1, witness); err == nil {
+		t.Error("verified checkpoint without witness cosignature")
+	}
+
+	cosigned, err := note.Sign(&note.Note{Text: string(log.Checkpoint{
+		Origin: "KeyDonkey",
+		Size:   22,
+		Hash:   make([]byte, 32),
+	}.Marshal())}, cosigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cosignature, _ := bytes.Cut(cosigned, []byte("\n\n"))
+	if _, err := VerifyCheckpoint(append(checkpoint, cosignature...), verifier, 1, witness); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,394 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"time"
+
+	"filippo.io/torchwood/prefix"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// instruments records the duration and errors of storage operations.
+type instruments struct {
+	store    attribute.KeyValue
+	duration metric.Float64Histogram
+	errors   metric.Int64Counter
+}
+
+func newInstruments(mp metric.MeterProvider, store string) (*instruments, error) {
+	meter := mp.Meter("github.com/codahale/keydonkey/internal/storage")
+
+	duration, err := meter.Float64Histogram("keydonkey.storage.duration",
+		metric.WithDescription("The duration of storage operations."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	errs, err := meter.Int64Counter("keydonkey.storage.errors",
+		metric.WithDescription("The number of failed storage operations."),
+		metric.WithUnit("{error}"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &instruments{
+		store:    attribute.String("keydonkey.store", store),
+		duration: duration,
+		errors:   errs,
+	}, nil
+}
+
+// record records the duration of an operation which started at the given time, and whether it failed.
+func (i *instruments) record(ctx context.Context, op string, start time.Time, err error) {
+	attrs := metric.WithAttributes(i.store, attribute.String("keydonkey.operation", op))
+	i.duration.Record(ctx, time.Since(start).Seconds(), attrs)
+	if err != nil {
+		i.errors.Add(ctx, 1, attrs)
+	}
+}
+
+// NewInstrumentedKeyStore returns a KeyStore which records metrics for the operations of the given KeyStore using the
+// given MeterProvider. The returned KeyStore implements VersionLister, IDLister, and Eraser if the given KeyStore does.
+func NewInstrumentedKeyStore(inner KeyStore, mp metric.MeterProvider) (KeyStore, error) {
+	inst, err := newInstruments(mp, "keys")
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := mp.Meter("github.com/codahale/keydonkey/internal/storage").Int64Counter("keydonkey.storage.keys.lookups",
+		metric.WithDescription("The number of key lookups, by whether a key was found."),
+		metric.WithUnit("{lookup}"))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &instrumentedKeyStore{inner: inner, inst: inst, found: found}
+	v, vOK := inner.(VersionLister)
+	i, iOK := inner.(IDLister)
+	e, eOK := inner.(Eraser)
+	lister, ids, eraser := &instrumentedVersionLister{s, v}, &instrumentedIDLister{s, i}, &instrumentedEraser{s, e}
+
+	// Only the capabilities of the underlying KeyStore are exposed, so that callers which check for them see the same
+	// result as they would without instrumentation.
+	switch {
+	case vOK && iOK && eOK:
+		return struct {
+			KeyStore
+			VersionLister
+			IDLister
+			Eraser
+		}{s, lister, ids, eraser}, nil
+	case vOK && iOK:
+		return struct {
+			KeyStore
+			VersionLister
+			IDLister
+		}{s, lister, ids}, nil
+	case vOK && eOK:
+		return struct {
+			KeyStore
+			VersionLister
+			Eraser
+		}{s, lister, eraser}, nil
+	case iOK && eOK:
+		return struct {
+			KeyStore
+			IDLister
+			Eraser
+		}{s, ids, eraser}, nil
+	case vOK:
+		return struct {
+			KeyStore
+			VersionLister
+		}{s, lister}, nil
+	case iOK:
+		return struct {
+			KeyStore
+			IDLister
+		}{s, ids}, nil
+	case eOK:
+		return struct {
+			KeyStore
+			Eraser
+		}{s, eraser}, nil
+	default:
+		return s, nil
+	}
+}
+
+// instrumentedKeyStore records metrics for the operations of an underlying KeyStore.
+type instrumentedKeyStore struct {
+	inner KeyStore
+	inst  *instruments
+	found metric.Int64Counter
+}
+
+func (s *instrumentedKeyStore) Get(ctx context.Context, id string, minVersion uint64) (found bool, pk []byte, version uint64, err error) {
+	defer func(start time.Time) {
+		s.inst.record(ctx, "get", start, err)
+		if err == nil {
+			s.found.Add(ctx, 1, metric.WithAttributes(attribute.Bool("keydonkey.found", found)))
+		}
+	}(time.Now())
+
+	return s.inner.Get(ctx, id, minVersion)
+}
+
+func (s *instrumentedKeyStore) Put(ctx context.Context, id string, pk []byte, version uint64) (err error) {
+	defer func(start time.Time) { s.inst.record(ctx, "put", start, err) }(time.Now())
+
+	return s.inner.Put(ctx, id, pk, version)
+}
+
+// instrumentedVersionLister records metrics for the operations of an underlying VersionLister.
+type instrumentedVersionLister struct {
+	s     *instrumentedKeyStore
+	inner VersionLister
+}
+
+func (l *instrumentedVersionLister) Versions(ctx context.Context, id string) (versions []uint64, err error) {
+	defer func(start time.Time) { l.s.inst.record(ctx, "versions", start, err) }(time.Now())
+
+	return l.inner.Versions(ctx, id)
+}
+
+func (l *instrumentedVersionLister) GetVersion(ctx context.Context, id string, version uint64) (found bool, pk []byte, err error) {
+	defer func(start time.Time) { l.s.inst.record(ctx, "get_version", start, err) }(time.Now())
+
+	return l.inner.GetVersion(ctx, id, version)
+}
+
+// instrumentedIDLister records metrics for the operations of an underlying IDLister.
+type instrumentedIDLister struct {
+	s     *instrumentedKeyStore
+	inner IDLister
+}
+
+func (l *instrumentedIDLister) IDs(ctx context.Context) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		var err error
+		defer func(start time.Time) { l.s.inst.record(ctx, "ids", start, err) }(time.Now())
+
+		for id, idErr := range l.inner.IDs(ctx) {
+			err = idErr
+			if !yield(id, idErr) {
+				return
+			}
+		}
+	}
+}
+
+// instrumentedEraser records metrics for the operations of an underlying Eraser.
+type instrumentedEraser struct {
+	s     *instrumentedKeyStore
+	inner Eraser
+}
+
+func (e *instrumentedEraser) Erase(ctx context.Context, id string, version uint64, pseudonym, commitment []byte) (err error) {
+	defer func(start time.Time) { e.s.inst.record(ctx, "erase", start, err) }(time.Now())
+
+	return e.inner.Erase(ctx, id, version, pseudonym, commitment)
+}
+
+func (e *instrumentedEraser) Tombstones(ctx context.Context, pseudonym []byte) (tombstones []Tombstone, err error) {
+	defer func(start time.Time) { e.s.inst.record(ctx, "tombstones", start, err) }(time.Now())
+
+	return e.inner.Tombstones(ctx, pseudonym)
+}
+
+// InstrumentedNodeStore is a NodeStore which records metrics for the operations of an underlying NodeStore.
+type InstrumentedNodeStore struct {
+	inner  NodeStore
+	inst   *instruments
+	stored metric.Int64Counter
+}
+
+// NewInstrumentedNodeStore returns an InstrumentedNodeStore which records metrics using the given MeterProvider.
+func NewInstrumentedNodeStore(inner NodeStore, mp metric.MeterProvider) (*InstrumentedNodeStore, error) {
+	inst, err := newInstruments(mp, "nodes")
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := mp.Meter("github.com/codahale/keydonkey/internal/storage").Int64Counter("keydonkey.storage.nodes.stored",
+		metric.WithDescription("The number of prefix tree nodes stored."),
+		metric.WithUnit("{node}"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &InstrumentedNodeStore{inner: inner, inst: inst, stored: stored}, nil
+}
+
+func (s *InstrumentedNodeStore) Load(ctx context.Context, label prefix.Label) (node *prefix.Node, err error) {
+	defer func(start time.Time) {
+		// A missing node is an expected result of looking up a label which isn't in the tree.
+		if errors.Is(err, prefix.ErrNodeNotFound) {
+			s.inst.record(ctx, "load", start, nil)
+		} else {
+			s.inst.record(ctx, "load", start, err)
+		}
+	}(time.Now())
+
+	return s.inner.Load(ctx, label)
+}
+
+func (s *InstrumentedNodeStore) Store(ctx context.Context, nodes ...*prefix.Node) (err error) {
+	defer func(start time.Time) {
+		s.inst.record(ctx, "store", start, err)
+		if err == nil {
+			s.stored.Add(ctx, int64(len(nodes)))
+		}
+	}(time.Now())
+
+	return s.inner.Store(ctx, nodes...)
+}
+
+// Close closes the underlying NodeStore, if it implements io.Closer.
+func (s *InstrumentedNodeStore) Close() error {
+	if c, ok := s.inner.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+var _ NodeStore = (*InstrumentedNodeStore)(nil)
+
+// NewInstrumentedLogStore returns a LogStore which records metrics for the operations of the given LogStore using the
+// given MeterProvider. The returned LogStore implements RootLogger, LogIntegrator, and CheckpointReader if the given
+// LogStore does.
+func NewInstrumentedLogStore(inner LogStore, mp metric.MeterProvider) (LogStore, error) {
+	inst, err := newInstruments(mp, "log")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &instrumentedLogStore{inner: inner, inst: inst}
+	r, rOK := inner.(RootLogger)
+	i, iOK := inner.(LogIntegrator)
+	c, cOK := inner.(CheckpointReader)
+	logger, integrator, reader := &instrumentedRootLogger{s, r}, &instrumentedLogIntegrator{s, i}, &instrumentedCheckpointReader{s, c}
+
+	// Only the capabilities of the underlying LogStore are exposed, so that callers which check for them see the same
+	// result as they would without instrumentation.
+	switch {
+	case rOK && iOK && cOK:
+		return struct {
+			LogStore
+			RootLogger
+			LogIntegrator
+			CheckpointReader
+		}{s, logger, integrator, reader}, nil
+	case rOK && iOK:
+		return struct {
+			LogStore
+			RootLogger
+			LogIntegrator
+		}{s, logger, integrator}, nil
+	case rOK && cOK:
+		return struct {
+			LogStore
+			RootLogger
+			CheckpointReader
+		}{s, logger, reader}, nil
+	case iOK && cOK:
+		return struct {
+			LogStore
+			LogIntegrator
+			CheckpointReader
+		}{s, integrator, reader}, nil
+	case rOK:
+		return struct {
+			LogStore
+			RootLogger
+		}{s, logger}, nil
+	case iOK:
+		return struct {
+			LogStore
+			LogIntegrator
+		}{s, integrator}, nil
+	case cOK:
+		return struct {
+			LogStore
+			CheckpointReader
+		}{s, reader}, nil
+	default:
+		return s, nil
+	}
+}
+
+// instrumentedLogStore records metrics for the operations of an underlying LogStore.
+type instrumentedLogStore struct {
+	inner LogStore
+	inst  *instruments
+}
+
+func (s *instrumentedLogStore) Add(ctx context.Context, label, commitment []byte) (index uint64, err error) {
+	defer func(start time.Time) { s.inst.record(ctx, "add", start, err) }(time.Now())
+
+	return s.inner.Add(ctx, label, commitment)
+}
+
+// instrumentedRootLogger records metrics for the operations of an underlying RootLogger.
+type instrumentedRootLogger struct {
+	s     *instrumentedLogStore
+	inner RootLogger
+}
+
+func (l *instrumentedRootLogger) AddRoot(ctx context.Context, root LogRoot) (index uint64, err error) {
+	defer func(start time.Time) { l.s.inst.record(ctx, "add_root", start, err) }(time.Now())
+
+	return l.inner.AddRoot(ctx, root)
+}
+
+func (l *instrumentedRootLogger) LatestRoot(ctx context.Context) (root *LogRoot, index uint64, err error) {
+	defer func(start time.Time) { l.s.inst.record(ctx, "latest_root", start, err) }(time.Now())
+
+	return l.inner.LatestRoot(ctx)
+}
+
+// instrumentedLogIntegrator records metrics for the operations of an underlying LogIntegrator.
+type instrumentedLogIntegrator struct {
+	s     *instrumentedLogStore
+	inner LogIntegrator
+}
+
+func (i *instrumentedLogIntegrator) AddAndWait(ctx context.Context, label, commitment []byte) (inclusion *Inclusion, err error) {
+	defer func(start time.Time) { i.s.inst.record(ctx, "add_and_wait", start, err) }(time.Now())
+
+	return i.inner.AddAndWait(ctx, label, commitment)
+}
+
+func (i *instrumentedLogIntegrator) Wait(ctx context.Context, index uint64) (inclusion *Inclusion, err error) {
+	defer func(start time.Time) { i.s.inst.record(ctx, "wait", start, err) }(time.Now())
+
+	return i.inner.Wait(ctx, index)
+}
+
+// instrumentedCheckpointReader records metrics for the operations of an underlying CheckpointReader.
+type instrumentedCheckpointReader struct {
+	s     *instrumentedLogStore
+	inner CheckpointReader
+}
+
+func (r *instrumentedCheckpointReader) LatestCheckpoint(ctx context.Context) (checkpoint []byte, err error) {
+	defer func(start time.Time) { r.s.inst.record(ctx, "latest_checkpoint", start, err) }(time.Now())
+
+	return r.inner.LatestCheckpoint(ctx)
+}
+
+var (
+	_ KeyStore         = (*instrumentedKeyStore)(nil)
+	_ VersionLister    = (*instrumentedVersionLister)(nil)
+	_ IDLister         = (*instrumentedIDLister)(nil)
+	_ Eraser           = (*instrumentedEraser)(nil)
+	_ LogStore         = (*instrumentedLogStore)(nil)
+	_ RootLogger       = (*instrumentedRootLogger)(nil)
+	_ LogIntegrator    = (*instrumentedLogIntegrator)(nil)
+	_ CheckpointReader = (*instrumentedCheckpointReader)(nil)
+)
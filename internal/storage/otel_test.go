@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestInstrumentedKeyStoreCapabilities(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	fsKeys, err := NewFSKeyStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = fsKeys.Close() })
+
+	keys, err := NewInstrumentedKeyStore(fsKeys, noop.NewMeterProvider())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := keys.(VersionLister); !ok {
+		t.Error("instrumented FSKeyStore is not a VersionLister")
+	}
+	if _, ok := keys.(IDLister); !ok {
+		t.Error("instrumented FSKeyStore is not an IDLister")
+	}
+	if _, ok := keys.(Eraser); !ok {
+		t.Error("instrumented FSKeyStore is not an Eraser")
+	}
+
+	keys, err = NewInstrumentedKeyStore(getOnlyKeyStore{}, noop.NewMeterProvider())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := keys.(VersionLister); ok {
+		t.Error("instrumented KeyStore is a VersionLister")
+	}
+	if _, ok := keys.(IDLister); ok {
+		t.Error("instrumented KeyStore is an IDLister")
+	}
+	if _, ok := keys.(Eraser); ok {
+		t.Error("instrumented KeyStore is an Eraser")
+	}
+}
+
+func TestInstrumentedLogStoreCapabilities(t *testing.T) {
+	log, err := NewInstrumentedLogStore(addOnlyLogStore{}, noop.NewMeterProvider())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := log.(RootLogger); ok {
+		t.Error("instrumented LogStore is a RootLogger")
+	}
+	if _, ok := log.(LogIntegrator); ok {
+		t.Error("instrumented LogStore is a LogIntegrator")
+	}
+	if _, ok := log.(CheckpointReader); ok {
+		t.Error("instrumented LogStore is a CheckpointReader")
+	}
+
+	log, err = NewInstrumentedLogStore(checkpointLogStore{}, noop.NewMeterProvider())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := log.(RootLogger); ok {
+		t.Error("instrumented LogStore is a RootLogger")
+	}
+	if _, ok := log.(CheckpointReader); !ok {
+		t.Error("instrumented LogStore is not a CheckpointReader")
+	}
+}
+
+type getOnlyKeyStore struct{}
+
+func (getOnlyKeyStore) Get(context.Context, string, uint64) (bool, []byte, uint64, error) {
+	return false, nil, 0, nil
+}
+
+func (getOnlyKeyStore) Put(context.Context, string, []byte, uint64) error {
+	return nil
+}
+
+type addOnlyLogStore struct{}
+
+func (addOnlyLogStore) Add(context.Context, []byte, []byte) (uint64, error) {
+	return 0, nil
+}
+
+type checkpointLogStore struct {
+	addOnlyLogStore
+}
+
+func (checkpointLogStore) LatestCheckpoint(context.Context) ([]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,480 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/torchwood/prefix"
+)
+
+// PackNodeStore is a log-structured NodeStore which appends nodes to a sequence of segment files rather than storing
+// each node in its own file. Each call to Store is an epoch, and every version of a node is tagged with the epoch in
+// which it was written, which allows the tree to be read as of an earlier epoch via Snapshot. An in-memory index of
+// each node's versions is rebuilt from the segments on open. Superseded versions remain in their segments until Collect
+// or Compact is called.
+type PackNodeStore struct {
+	root        *os.Root
+	segmentSize int64
+	now         func() time.Time
+
+	// gcMu serializes calls to Collect.
+	gcMu sync.Mutex
+
+	mu       sync.RWMutex
+	epoch    uint64
+	index    map[prefix.Label][]packVersion
+	segments map[uint32]*packSegment
+	active   *packSegment
+
+	// collected contains the epochs of the collected root versions, in ascending order.
+	collected []uint64
+}
+
+// DefaultSegmentSize is the size at which a PackNodeStore starts a new segment file.
+const DefaultSegmentSize = 64 << 20
+
+// NewPackNodeStore opens or creates a PackNodeStore in the "packs" directory of the given root. If the last segment
+// ends with a partially-written batch of records, such as an epoch whose Store was interrupted, the batch is discarded.
+func NewPackNodeStore(root *os.Root) (*PackNodeStore, error) {
+	if err := root.Mkdir("packs", 0777); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, err
+	}
+
+	root, err := root.OpenRoot("packs")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &PackNodeStore{
+		root:        root,
+		segmentSize: DefaultSegmentSize,
+		now:         time.Now,
+		index:       make(map[prefix.Label][]packVersion),
+		segments:    make(map[uint32]*packSegment),
+	}
+
+	ids, err := s.segmentIDs()
+	if err != nil {
+		_ = root.Close()
+		return nil, err
+	}
+
+	if err := s.readCollected(); err != nil {
+		_ = root.Close()
+		return nil, err
+	}
+
+	for i, id := range ids {
+		if err := s.openSegment(id, i == len(ids)-1); err != nil {
+			_ = s.Close()
+			return nil, err
+		}
+	}
+
+	if s.active == nil {
+		if err := s.rotate(); err != nil {
+			_ = s.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *PackNodeStore) Load(_ context.Context, label prefix.Label) (*prefix.Node, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	node, _, err := s.load(label, s.epoch)
+	return node, err
+}
+
+func (s *PackNodeStore) Store(_ context.Context, nodes ...*prefix.Node) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.epoch++
+	records := make([]packRecord, len(nodes))
+	for i, node := range nodes {
+		records[i] = packRecord{node: node, version: packVersion{epoch: s.epoch, time: s.now().UnixNano()}}
+	}
+	return s.append(records)
+}
+
+// Compact removes every superseded node version, retaining only the current tree, and rewrites the remaining nodes of
+// any sealed segment which contained removed versions.
+func (s *PackNodeStore) Compact(ctx context.Context) error {
+	_, err := s.Collect(ctx, RetentionPolicy{})
+	return err
+}
+
+// PackStats records the number of records in a PackNodeStore and how many of them are live.
+type PackStats struct {
+	Segments      int
+	Records, Live int64
+}
+
+// Stats returns the number of segments, records, and live records in the store.
+func (s *PackNodeStore) Stats() PackStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := PackStats{Segments: len(s.segments)}
+	for _, seg := range s.segments {
+		stats.Records += seg.records
+		stats.Live += seg.live
+	}
+	return stats
+}
+
+func (s *PackNodeStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	if s.active != nil {
+		errs = append(errs, s.active.f.Sync())
+	}
+	for _, seg := range s.segments {
+		errs = append(errs, seg.f.Close())
+	}
+	errs = append(errs, s.root.Close())
+	return errors.Join(errs...)
+}
+
+// load returns the latest version of the node with the given label written at or before the given epoch. The caller
+// must hold s.mu.
+func (s *PackNodeStore) load(label prefix.Label, epoch uint64) (*prefix.Node, packVersion, error) {
+	versions := s.index[label]
+	i, _ := slices.BinarySearchFunc(versions, epoch+1, func(v packVersion, epoch uint64) int {
+		return cmp.Compare(v.epoch, epoch)
+	})
+	if i == 0 {
+		return nil, packVersion{}, prefix.ErrNodeNotFound
+	}
+	v := versions[i-1]
+
+	rec, err := s.read(v.loc)
+	if err != nil {
+		return nil, packVersion{}, err
+	}
+	return rec.node, v, nil
+}
+
+// read reads the record at the given location. The caller must hold s.mu.
+func (s *PackNodeStore) read(loc packLocation) (packRecord, error) {
+	var b [packRecordSize]byte
+	if _, err := s.segments[loc.segment].f.ReadAt(b[:], loc.offset); err != nil {
+		return packRecord{}, err
+	}
+	rec, _, err := decodePackRecord(b[:])
+	return rec, err
+}
+
+// append writes the given records to the active segment, starting a new segment first if they do not fit. The caller
+// must hold s.mu for writing.
+func (s *PackNodeStore) append(records []packRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	// Each record counts the records after it in the batch, so that an incomplete batch can be discarded on open.
+	b := make([]byte, 0, len(records)*packRecordSize)
+	for i, rec := range records {
+		b = appendPackRecord(b, rec, uint32(len(records)-1-i))
+	}
+
+	if s.active.size > packHeaderSize && s.active.size+int64(len(b)) > s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.active.f.WriteAt(b, s.active.size); err != nil {
+		return err
+	}
+	if err := s.active.f.Sync(); err != nil {
+		return err
+	}
+
+	for i, rec := range records {
+		rec.version.loc = packLocation{segment: s.active.id, offset: s.active.size + int64(i*packRecordSize)}
+		s.addVersion(rec.node.Label, rec.version)
+	}
+	s.active.size += int64(len(b))
+
+	return nil
+}
+
+// addVersion records the location of a version of the node with the given label. If the index already contains that
+// version, its location is replaced. The caller must hold s.mu for writing.
+func (s *PackNodeStore) addVersion(label prefix.Label, v packVersion) {
+	seg := s.segments[v.loc.segment]
+	seg.records++
+	seg.live++
+	s.epoch = max(s.epoch, v.epoch)
+
+	versions := s.index[label]
+	i, found := slices.BinarySearchFunc(versions, v.epoch, func(v packVersion, epoch uint64) int {
+		return cmp.Compare(v.epoch, epoch)
+	})
+	if found {
+		s.segments[versions[i].loc.segment].live--
+		versions[i] = v
+		return
+	}
+	s.index[label] = slices.Insert(versions, i, v)
+}
+
+// compact rewrites the live records of every sealed segment which contains dead records into the active segment, then
+// removes the old segments. The caller must hold s.mu for writing.
+func (s *PackNodeStore) compact() error {
+	var victims []*packSegment
+	for _, seg := range s.segments {
+		if seg != s.active && seg.live < seg.records {
+			victims = append(victims, seg)
+		}
+	}
+	slices.SortFunc(victims, func(a, b *packSegment) int { return cmp.Compare(a.id, b.id) })
+
+	for _, seg := range victims {
+		var live []packRecord
+		for label, versions := range s.index {
+			for _, v := range versions {
+				if v.loc.segment != seg.id {
+					continue
+				}
+
+				rec, err := s.read(v.loc)
+				if err != nil {
+					return err
+				}
+				if rec.node.Label != label || rec.version.epoch != v.epoch {
+					return fmt.Errorf("storage: pack index for %s@%d points to %s@%d", label, v.epoch, rec.node.Label, rec.version.epoch)
+				}
+				live = append(live, rec)
+			}
+		}
+
+		// The copied nodes are durable once appended, so the only other copy can be removed.
+		if err := s.append(live); err != nil {
+			return err
+		}
+
+		if err := seg.f.Close(); err != nil {
+			return err
+		}
+		delete(s.segments, seg.id)
+		if err := s.root.Remove(seg.name()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rotate seals the active segment, if any, and starts a new one. The caller must hold s.mu for writing.
+func (s *PackNodeStore) rotate() error {
+	var id uint32
+	if s.active != nil {
+		if err := s.active.f.Sync(); err != nil {
+			return err
+		}
+		id = s.active.id + 1
+	}
+
+	seg := &packSegment{id: id, size: packHeaderSize}
+	f, err := s.root.OpenFile(seg.name(), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	seg.f = f
+
+	if _, err := f.WriteAt([]byte(packMagic), 0); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	s.segments[id] = seg
+	s.active = seg
+	return nil
+}
+
+// openSegment reads every complete batch of records in the segment with the given ID into the index. If last is true,
+// the segment becomes the active segment and any partially-written batch at its end is truncated.
+func (s *PackNodeStore) openSegment(id uint32, last bool) error {
+	seg := &packSegment{id: id}
+	f, err := s.root.OpenFile(seg.name(), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	seg.f = f
+	s.segments[id] = seg
+
+	var header [packHeaderSize]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil {
+		return fmt.Errorf("storage: %s: %w", seg.name(), err)
+	}
+	if string(header[:]) != packMagic {
+		return fmt.Errorf("storage: %s: not a pack segment", seg.name())
+	}
+
+	// The records of a batch are only indexed once its last record has been read.
+	seg.size = packHeaderSize
+	offset := seg.size
+	var batch []packRecord
+	var b [packRecordSize]byte
+	for {
+		_, err := f.ReadAt(b[:], offset)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		rec, remaining, err := decodePackRecord(b[:])
+		if err != nil {
+			if !last {
+				return fmt.Errorf("storage: %s: corrupt record at offset %d: %w", seg.name(), offset, err)
+			}
+			break
+		}
+
+		rec.version.loc = packLocation{segment: id, offset: offset}
+		batch = append(batch, rec)
+		offset += packRecordSize
+		if remaining == 0 {
+			for _, rec := range batch {
+				s.addVersion(rec.node.Label, rec.version)
+			}
+			batch = batch[:0]
+			seg.size = offset
+		}
+	}
+
+	if last {
+		// Discard any partially-written batch at the end of the segment.
+		if err := f.Truncate(seg.size); err != nil {
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			return err
+		}
+		s.active = seg
+	} else if seg.size != offset {
+		return fmt.Errorf("storage: %s: incomplete batch at offset %d", seg.name(), seg.size)
+	}
+
+	return nil
+}
+
+// segmentIDs returns the IDs of the existing segments in ascending order.
+func (s *PackNodeStore) segmentIDs() ([]uint32, error) {
+	entries, err := fs.ReadDir(s.root.FS(), ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint32
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), packExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		id, err := strconv.ParseUint(name, 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("storage: malformed segment filename %q", entry.Name())
+		}
+		ids = append(ids, uint32(id))
+	}
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+type packSegment struct {
+	id            uint32
+	f             *os.File
+	size          int64
+	records, live int64
+}
+
+func (seg *packSegment) name() string {
+	return fmt.Sprintf("%08x%s", seg.id, packExt)
+}
+
+type packLocation struct {
+	segment uint32
+	offset  int64
+}
+
+// packVersion is a version of a node, identified by the epoch in which it was written.
+type packVersion struct {
+	epoch uint64
+	time  int64
+	loc   packLocation
+}
+
+type packRecord struct {
+	node    *prefix.Node
+	version packVersion
+}
+
+// Each segment begins with a magic string identifying the format, followed by fixed-size records consisting of a node
+// in the binary node encoding, the 8-byte big-endian epoch and UNIX time in nanoseconds at which it was written, the
+// 4-byte big-endian number of records after it in the batch in which it was written, and a CRC-32C checksum of all of
+// them.
+const (
+	packExt        = ".pack"
+	packMagic      = "KDPACK02"
+	packHeaderSize = 8 // len(packMagic)
+	packRecordSize = nodeBinarySize + 8 + 8 + 4 + 4
+)
+
+var packCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+func appendPackRecord(b []byte, rec packRecord, remaining uint32) []byte {
+	start := len(b)
+	b = append(b, nodeToBytes(rec.node)...)
+	b = binary.BigEndian.AppendUint64(b, rec.version.epoch)
+	b = binary.BigEndian.AppendUint64(b, uint64(rec.version.time))
+	b = binary.BigEndian.AppendUint32(b, remaining)
+	return binary.BigEndian.AppendUint32(b, crc32.Checksum(b[start:], packCRCTable))
+}
+
+// decodePackRecord decodes a record and the number of records after it in its batch.
+func decodePackRecord(b []byte) (packRecord, uint32, error) {
+	if crc32.Checksum(b[:packRecordSize-4], packCRCTable) != binary.BigEndian.Uint32(b[packRecordSize-4:]) {
+		return packRecord{}, 0, errors.New("storage: pack record checksum mismatch")
+	}
+
+	node, err := bytesToNode(b[:nodeBinarySize])
+	if err != nil {
+		return packRecord{}, 0, err
+	}
+
+	rec := packRecord{
+		node: node,
+		version: packVersion{
+			epoch: binary.BigEndian.Uint64(b[nodeBinarySize:]),
+			time:  int64(binary.BigEndian.Uint64(b[nodeBinarySize+8:])),
+		},
+	}
+	return rec, binary.BigEndian.Uint32(b[nodeBinarySize+16:]), nil
+}
+
+var _ NodeStore = (*PackNodeStore)(nil)
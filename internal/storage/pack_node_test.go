@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"os"
+	"testing"
+
+	"filippo.io/torchwood/prefix"
+)
+
+func TestPackNodeStore(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	nodes, err := NewPackNodeStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes.segmentSize = 16 * packRecordSize
+
+	if err := prefix.InitStorage(t.Context(), sha256.Sum256, nodes); err != nil {
+		t.Fatal(err)
+	}
+	tree := prefix.NewTree(sha256.Sum256, nodes)
+	for i := range 32 {
+		if err := tree.Insert(t.Context(), sha256.Sum256([]byte{byte(i)}), [32]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rootHash, err := tree.RootHash(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, nodes, rootHash, 32)
+
+	before := nodes.Stats()
+	if before.Segments < 2 {
+		t.Fatalf("Stats() = %+v, want several segments", before)
+	}
+
+	if err := nodes.Compact(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	after := nodes.Stats()
+	if after.Live != after.Records || after.Records >= before.Records {
+		t.Errorf("Stats() = %+v after compacting %+v", after, before)
+	}
+	checkTree(t, nodes, rootHash, 32)
+
+	// A node of the current tree, as it would be rewritten by the next epoch.
+	var changed prefix.Node
+	for label := range nodes.index {
+		node, err := nodes.Load(t.Context(), label)
+		if err != nil {
+			t.Fatal(err)
+		}
+		changed = *node
+		changed.Hash[0] ^= 1
+		break
+	}
+	epoch := nodes.epoch + 1
+
+	if err := nodes.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a Store which was interrupted after writing the first of its two records and part of the second.
+	packs, err := root.OpenRoot("packs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = packs.Close() })
+	ids, err := (&PackNodeStore{root: packs}).segmentIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := packs.OpenFile((&packSegment{id: ids[len(ids)-1]}).name(), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := appendPackRecord(nil, packRecord{node: &changed, version: packVersion{epoch: epoch}}, 1)
+	if _, err := f.Write(append(b, make([]byte, packRecordSize/2)...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, err = NewPackNodeStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = nodes.Close() })
+	if got, want := nodes.Stats(), after; got != want {
+		t.Errorf("Stats() = %+v after reopening, want %+v", got, want)
+	}
+	checkTree(t, nodes, rootHash, 32)
+
+	tree = prefix.NewTree(sha256.Sum256, nodes)
+	if err := tree.Insert(t.Context(), sha256.Sum256([]byte("more")), [32]byte{}); err != nil {
+		t.Fatal(err)
+	}
+}
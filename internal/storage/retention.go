@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"filippo.io/torchwood/prefix"
+)
+
+// RetentionPolicy determines which prefix tree roots a PackNodeStore continues to serve proofs for after a collection.
+// The current root is always retained.
+type RetentionPolicy struct {
+	// Epochs is the number of most recent roots to retain.
+	Epochs int
+
+	// MaxAge is the age below which all roots are retained.
+	MaxAge time.Duration
+
+	// Pinned contains the epochs of additional roots to retain.
+	Pinned []uint64
+}
+
+// CollectStats records the results of a collection.
+type CollectStats struct {
+	// Roots is the number of retained roots.
+	Roots int
+
+	// Marked is the number of node versions reachable from the retained roots.
+	Marked int
+
+	// Swept is the number of node versions removed.
+	Swept int
+}
+
+// ErrEpochNotRetained is returned when reading a snapshot of a root which has been collected.
+var ErrEpochNotRetained = errors.New("storage: epoch not retained")
+
+// Root is a version of the prefix tree's root node.
+type Root struct {
+	Epoch uint64
+	Time  time.Time
+	Hash  [32]byte
+}
+
+// Epoch returns the current epoch, which is incremented on each call to Store.
+func (s *PackNodeStore) Epoch() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.epoch
+}
+
+// Roots returns the stored versions of the prefix tree's root node, in ascending order of epoch.
+func (s *PackNodeStore) Roots() ([]Root, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions := s.index[prefix.RootLabel]
+	roots := make([]Root, 0, len(versions))
+	for _, v := range versions {
+		rec, err := s.read(v.loc)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, Root{Epoch: v.epoch, Time: time.Unix(0, v.time), Hash: rec.node.Hash})
+	}
+
+	return roots, nil
+}
+
+// Snapshot returns a read-only NodeStore containing the tree as of the given epoch, which can be used to generate
+// proofs relative to that epoch's root. Loads from the snapshot return ErrEpochNotRetained if the epoch's root is
+// collected.
+func (s *PackNodeStore) Snapshot(epoch uint64) NodeStore {
+	return &packSnapshot{s: s, epoch: epoch}
+}
+
+// Collect removes every node version which is not reachable from a root retained by the given policy, then rewrites
+// the sealed segments containing removed versions. The store may be read and written concurrently: the reachable node
+// versions are marked without blocking writers, and versions written after marking begins are always retained.
+func (s *PackNodeStore) Collect(ctx context.Context, policy RetentionPolicy) (CollectStats, error) {
+	s.gcMu.Lock()
+	defer s.gcMu.Unlock()
+
+	// Versions written after the horizon are always retained.
+	horizon := s.Epoch()
+	roots, err := s.Roots()
+	if err != nil {
+		return CollectStats{}, err
+	}
+	roots = slices.DeleteFunc(roots, func(r Root) bool { return r.Epoch > horizon })
+
+	// Select the roots to retain.
+	retained := make(map[uint64]bool)
+	minTime := s.now().Add(-policy.MaxAge).UnixNano()
+	for i, root := range roots {
+		if i == len(roots)-1 || i >= len(roots)-policy.Epochs || (policy.MaxAge > 0 && root.Time.UnixNano() >= minTime) || slices.Contains(policy.Pinned, root.Epoch) {
+			retained[root.Epoch] = true
+		}
+	}
+
+	// Mark every node version reachable from a retained root. A node version determines the versions of all of its
+	// descendants, so marking stops at versions which have already been marked.
+	marked := make(map[packVersionKey]bool)
+	for epoch := range retained {
+		stack := []prefix.Label{prefix.RootLabel}
+		for len(stack) > 0 {
+			if err := ctx.Err(); err != nil {
+				return CollectStats{}, err
+			}
+
+			label := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			s.mu.RLock()
+			node, v, err := s.load(label, epoch)
+			s.mu.RUnlock()
+			if err != nil {
+				return CollectStats{}, fmt.Errorf("storage: marking %s@%d: %w", label, epoch, err)
+			}
+
+			key := packVersionKey{label: label, epoch: v.epoch}
+			if marked[key] {
+				continue
+			}
+			marked[key] = true
+
+			if label != prefix.EmptyNodeLabel && !label.IsLeaf() {
+				stack = append(stack, node.Left, node.Right)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Sweep every unmarked version written before marking began.
+	swept := 0
+	for label, versions := range s.index {
+		versions = slices.DeleteFunc(versions, func(v packVersion) bool {
+			if v.epoch > horizon || marked[packVersionKey{label: label, epoch: v.epoch}] {
+				return false
+			}
+			if label == prefix.RootLabel {
+				s.collected = append(s.collected, v.epoch)
+			}
+			s.segments[v.loc.segment].live--
+			swept++
+			return true
+		})
+		if len(versions) == 0 {
+			delete(s.index, label)
+		} else {
+			s.index[label] = versions
+		}
+	}
+	slices.Sort(s.collected)
+
+	// Record the collected roots before their records are removed, so that snapshots of them are still rejected after
+	// the store is reopened.
+	if err := s.writeCollected(); err != nil {
+		return CollectStats{}, err
+	}
+
+	// Seal the active segment if it contains dead records, so that they are removed too.
+	if s.active.live < s.active.records {
+		if err := s.rotate(); err != nil {
+			return CollectStats{}, err
+		}
+	}
+
+	if err := s.compact(); err != nil {
+		return CollectStats{}, err
+	}
+
+	return CollectStats{Roots: len(retained), Marked: len(marked), Swept: swept}, nil
+}
+
+// writeCollected atomically replaces the file containing the epochs of the collected roots. The caller must hold s.mu
+// for writing.
+func (s *PackNodeStore) writeCollected() error {
+	b := make([]byte, 0, 8*len(s.collected))
+	for _, epoch := range s.collected {
+		b = binary.BigEndian.AppendUint64(b, epoch)
+	}
+
+	f, err := s.root.OpenFile(collectedFilename+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return s.root.Rename(collectedFilename+".tmp", collectedFilename)
+}
+
+// readCollected reads the epochs of the collected roots, if any.
+func (s *PackNodeStore) readCollected() error {
+	b, err := s.root.ReadFile(collectedFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(b)%8 != 0 {
+		return fmt.Errorf("storage: malformed %s", collectedFilename)
+	}
+
+	s.collected = make([]uint64, 0, len(b)/8)
+	for ; len(b) > 0; b = b[8:] {
+		s.collected = append(s.collected, binary.BigEndian.Uint64(b))
+	}
+	return nil
+}
+
+const collectedFilename = "collected"
+
+type packVersionKey struct {
+	label prefix.Label
+	epoch uint64
+}
+
+type packSnapshot struct {
+	s     *PackNodeStore
+	epoch uint64
+}
+
+func (ps *packSnapshot) Load(_ context.Context, label prefix.Label) (*prefix.Node, error) {
+	ps.s.mu.RLock()
+	defer ps.s.mu.RUnlock()
+
+	if ps.epoch > ps.s.epoch {
+		return nil, fmt.Errorf("storage: epoch %d is in the future", ps.epoch)
+	}
+
+	// Find the version of the root which was current as of the snapshot's epoch. If a later version at or before the
+	// snapshot's epoch has been collected, the snapshot's root is no longer available.
+	root, v, err := ps.s.load(prefix.RootLabel, ps.epoch)
+	if err != nil && !errors.Is(err, prefix.ErrNodeNotFound) {
+		return nil, err
+	}
+	i, _ := slices.BinarySearch(ps.s.collected, v.epoch+1)
+	if i < len(ps.s.collected) && ps.s.collected[i] <= ps.epoch {
+		return nil, ErrEpochNotRetained
+	}
+	if root == nil {
+		return nil, prefix.ErrNodeNotFound
+	}
+	if label == prefix.RootLabel {
+		return root, nil
+	}
+
+	// Nodes are loaded as of the root's epoch, as only the versions reachable from it are retained.
+	node, _, err := ps.s.load(label, v.epoch)
+	return node, err
+}
+
+func (ps *packSnapshot) Store(context.Context, ...*prefix.Node) error {
+	return errors.New("storage: snapshots are read-only")
+}
+
+var _ NodeStore = (*packSnapshot)(nil)
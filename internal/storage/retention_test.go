@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"filippo.io/torchwood/prefix"
+)
+
+func TestPackNodeStoreCollect(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	nodes, err := NewPackNodeStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes.segmentSize = 16 * packRecordSize
+	now := time.Unix(1_000_000, 0)
+	nodes.now = func() time.Time { return now }
+
+	if err := prefix.InitStorage(t.Context(), sha256.Sum256, nodes); err != nil {
+		t.Fatal(err)
+	}
+	tree := prefix.NewTree(sha256.Sum256, nodes)
+	insert := func(i int) {
+		t.Helper()
+		if err := tree.Insert(t.Context(), sha256.Sum256([]byte{byte(i)}), [32]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Insert 8 keys a day apart, then 8 more keys an hour apart.
+	for i := range 16 {
+		if i < 8 {
+			now = now.Add(24 * time.Hour)
+		} else {
+			now = now.Add(time.Hour)
+		}
+		insert(i)
+	}
+	pinned := uint64(4) // InitStorage is epoch 1, so the third key is inserted in epoch 4.
+
+	roots, err := nodes.Roots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(roots), 17; got != want {
+		t.Fatalf("len(Roots()) = %d, want %d", got, want)
+	}
+
+	stats, err := nodes.Collect(t.Context(), RetentionPolicy{Epochs: 2, MaxAge: 7 * time.Hour, Pinned: []uint64{pinned}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last 8 epochs are within 7 hours, plus one pinned epoch.
+	if got, want := stats.Roots, 9; got != want {
+		t.Errorf("Roots = %d, want %d", got, want)
+	}
+	if stats.Swept == 0 {
+		t.Error("nothing swept")
+	}
+	if got := nodes.Stats(); got.Live != got.Records {
+		t.Errorf("Stats() = %+v after collection", got)
+	}
+
+	for _, r := range roots {
+		snapshot := prefix.NewTree(sha256.Sum256, nodes.Snapshot(r.Epoch))
+		rootHash, err := snapshot.RootHash(t.Context())
+		if r.Epoch != pinned && r.Epoch < 10 {
+			if !errors.Is(err, ErrEpochNotRetained) {
+				t.Errorf("epoch %d: RootHash() = %x, %v, want ErrEpochNotRetained", r.Epoch, rootHash, err)
+			}
+			continue
+		}
+		if err != nil || rootHash != r.Hash {
+			t.Fatalf("epoch %d: RootHash() = %x, %v, want %x", r.Epoch, rootHash, err, r.Hash)
+		}
+
+		// Every key inserted as of the snapshot's epoch has a valid proof against its root.
+		for i := range int(r.Epoch) - 1 {
+			found, proof, err := snapshot.Lookup(t.Context(), sha256.Sum256([]byte{byte(i)}))
+			if err != nil || !found {
+				t.Fatalf("epoch %d: Lookup(%d) = %v, %v", r.Epoch, i, found, err)
+			}
+			if err := prefix.VerifyMembershipProof(sha256.Sum256, sha256.Sum256([]byte{byte(i)}), [32]byte{byte(i)}, proof, r.Hash); err != nil {
+				t.Errorf("epoch %d: %v", r.Epoch, err)
+			}
+		}
+	}
+
+	// Collections can run while the tree is being written.
+	done := make(chan error)
+	go func() {
+		_, err := nodes.Collect(t.Context(), RetentionPolicy{Epochs: 1})
+		done <- err
+	}()
+	for i := 16; i < 24; i++ {
+		insert(i)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Collected roots stay collected after reopening.
+	rootHash, err := tree.RootHash(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes.Close(); err != nil {
+		t.Fatal(err)
+	}
+	nodes, err = NewPackNodeStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = nodes.Close() })
+	if _, err := nodes.Snapshot(5).Load(t.Context(), prefix.RootLabel); !errors.Is(err, ErrEpochNotRetained) {
+		t.Errorf("Load() = %v, want ErrEpochNotRetained", err)
+	}
+	checkTree(t, nodes, rootHash, 24)
+}
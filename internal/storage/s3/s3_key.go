@@ -7,8 +7,11 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"iter"
 	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -85,12 +88,175 @@ func (s *KeyStore) Put(ctx context.Context, id string, pk []byte, version uint64
 	return err
 }
 
+func (s *KeyStore) Versions(ctx context.Context, id string) ([]uint64, error) {
+	glob, _ := keyGlobAndFilename(id, 0)
+
+	var versions []uint64
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(glob + "/"),
+	})
+	for paginator.HasMorePages() {
+		listResp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range listResp.Contents {
+			version, err := keyVersion(path.Base(*object.Key))
+			if err != nil {
+				return nil, err
+			}
+			versions = append(versions, version)
+		}
+	}
+	slices.Sort(versions)
+
+	return versions, nil
+}
+
+func (s *KeyStore) GetVersion(ctx context.Context, id string, version uint64) (found bool, pk []byte, err error) {
+	_, filename := keyGlobAndFilename(id, version)
+
+	getResp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(filename),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "NoSuchKey") {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	defer func() { _ = getResp.Body.Close() }()
+
+	var key keyData
+	if err := json.NewDecoder(getResp.Body).Decode(&key); err != nil {
+		return false, nil, err
+	}
+
+	return true, key.PK, nil
+}
+
+func (s *KeyStore) IDs(ctx context.Context) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		// Object keys are derived from a hash of the ID, so an object must be read to recover it. Objects are listed
+		// in lexical order, so all the versions of an ID are adjacent.
+		var last string
+		paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(s.bucket),
+		})
+		for paginator.HasMorePages() {
+			listResp, err := paginator.NextPage(ctx)
+			if err != nil {
+				yield("", err)
+				return
+			}
+
+			for _, object := range listResp.Contents {
+				hexLabel := path.Dir(*object.Key)
+				if hexLabel == last || strings.HasPrefix(*object.Key, erasedPrefix) {
+					continue
+				}
+
+				getResp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+					Bucket: aws.String(s.bucket),
+					Key:    object.Key,
+				})
+				if err != nil {
+					yield("", err)
+					return
+				}
+
+				var key keyData
+				err = json.NewDecoder(getResp.Body).Decode(&key)
+				_ = getResp.Body.Close()
+				if err != nil {
+					yield("", err)
+					return
+				}
+
+				last = hexLabel
+				if !yield(key.ID, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Erase writes a tombstone for the given version to an object named after the pseudonym, then deletes the key's
+// object. If the bucket has versioning enabled, prior object versions must be expired separately.
+func (s *KeyStore) Erase(ctx context.Context, id string, version uint64, pseudonym, commitment []byte) error {
+	b, err := json.Marshal(&storage.Tombstone{Version: version, Commitment: commitment})
+	if err != nil {
+		return err
+	}
+
+	_, tombstone := tombstoneGlobAndFilename(pseudonym, version)
+	if _, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(tombstone),
+		Body:   bytes.NewReader(b),
+	}); err != nil {
+		return err
+	}
+
+	_, filename := keyGlobAndFilename(id, version)
+	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(filename),
+	})
+
+	return err
+}
+
+func (s *KeyStore) Tombstones(ctx context.Context, pseudonym []byte) ([]storage.Tombstone, error) {
+	glob, _ := tombstoneGlobAndFilename(pseudonym, 0)
+
+	// Versions are zero-padded, so objects are listed in order of version.
+	var tombstones []storage.Tombstone
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(glob + "/"),
+	})
+	for paginator.HasMorePages() {
+		listResp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range listResp.Contents {
+			getResp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+				Bucket: aws.String(s.bucket),
+				Key:    object.Key,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			var t storage.Tombstone
+			err = json.NewDecoder(getResp.Body).Decode(&t)
+			_ = getResp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			tombstones = append(tombstones, t)
+		}
+	}
+
+	return tombstones, nil
+}
+
 type keyData struct {
 	ID      string
 	PK      []byte
 	Version uint64
 }
 
+// erasedPrefix is the prefix of the objects in which tombstones are stored.
+const erasedPrefix = "erased/"
+
 func keyGlobAndFilename(id string, version uint64) (glob, filename string) {
 	hash := sha256.Sum256([]byte(id))
 	hexLabel := hex.EncodeToString(hash[:])
@@ -99,4 +265,24 @@ func keyGlobAndFilename(id string, version uint64) (glob, filename string) {
 	return glob, filename
 }
 
-var _ storage.KeyStore = (*KeyStore)(nil)
+func tombstoneGlobAndFilename(pseudonym []byte, version uint64) (glob, filename string) {
+	hexPseudonym := hex.EncodeToString(pseudonym)
+	glob = path.Join(erasedPrefix, hexPseudonym[:2], hexPseudonym[2:4], hexPseudonym)
+	filename = path.Join(glob, fmt.Sprintf("%s-%016x.json", hexPseudonym, version))
+	return glob, filename
+}
+
+func keyVersion(name string) (uint64, error) {
+	_, hexVersion, ok := strings.Cut(strings.TrimSuffix(name, ".json"), "-")
+	if !ok {
+		return 0, fmt.Errorf("s3: malformed key filename %q", name)
+	}
+	return strconv.ParseUint(hexVersion, 16, 64)
+}
+
+var (
+	_ storage.KeyStore      = (*KeyStore)(nil)
+	_ storage.VersionLister = (*KeyStore)(nil)
+	_ storage.IDLister      = (*KeyStore)(nil)
+	_ storage.Eraser        = (*KeyStore)(nil)
+)
@@ -0,0 +1,132 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestKeyStoreGetVersion(t *testing.T) {
+	keys := NewKeyStore("keys", newTestClient(t))
+
+	for version := range uint64(2) {
+		if err := keys.Put(t.Context(), "dingus", []byte{byte(version)}, version); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, pk, err := keys.GetVersion(t.Context(), "dingus", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || !bytes.Equal(pk, []byte{1}) {
+		t.Errorf("GetVersion(1) = %v, %x, want found with %x", found, pk, []byte{1})
+	}
+
+	if found, _, err := keys.GetVersion(t.Context(), "dingus", 2); err != nil || found {
+		t.Errorf("GetVersion(2) = %v, %v, want not found", found, err)
+	}
+
+	// Erased versions are no longer found, but their tombstones are.
+	pseudonym := []byte("pseudonym")
+	if err := keys.Erase(t.Context(), "dingus", 0, pseudonym, []byte("commitment")); err != nil {
+		t.Fatal(err)
+	}
+	if found, _, err := keys.GetVersion(t.Context(), "dingus", 0); err != nil || found {
+		t.Errorf("GetVersion(0) = %v, %v, want not found", found, err)
+	}
+	if found, _, err := keys.GetVersion(t.Context(), "dingus", 1); err != nil || !found {
+		t.Errorf("GetVersion(1) = %v, %v, want found", found, err)
+	}
+
+	tombstones, err := keys.Tombstones(t.Context(), pseudonym)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tombstones) != 1 || tombstones[0].Version != 0 || !bytes.Equal(tombstones[0].Commitment, []byte("commitment")) {
+		t.Errorf("Tombstones() = %+v, want version 0", tombstones)
+	}
+
+	var ids []string
+	for id, err := range keys.IDs(t.Context()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if want := []string{"dingus"}; !slices.Equal(ids, want) {
+		t.Errorf("IDs() = %v, want %v", ids, want)
+	}
+}
+
+// newTestClient returns an S3 client for an in-memory server which implements enough of the S3 API for KeyStore.
+func newTestClient(t *testing.T) *s3.Client {
+	t.Helper()
+
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		_, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		switch {
+		case r.Method == http.MethodPut:
+			b, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			objects[key] = b
+		case r.Method == http.MethodDelete:
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet && key == "":
+			type object struct{ Key string }
+			var res struct {
+				XMLName     xml.Name `xml:"ListBucketResult"`
+				IsTruncated bool
+				Contents    []object
+			}
+			for k := range objects {
+				if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+					res.Contents = append(res.Contents, object{Key: k})
+				}
+			}
+			slices.SortFunc(res.Contents, func(a, b object) int { return strings.Compare(a.Key, b.Key) })
+			w.Header().Set("Content-Type", "application/xml")
+			_ = xml.NewEncoder(w).Encode(&res)
+		case r.Method == http.MethodGet:
+			b, ok := objects[key]
+			if !ok {
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = io.WriteString(w, "<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>")
+				return
+			}
+			_, _ = w.Write(b)
+		default:
+			http.Error(w, "unsupported", http.StatusNotImplemented)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return s3.New(s3.Options{
+		Region:                     "us-east-1",
+		BaseEndpoint:               aws.String(srv.URL),
+		UsePathStyle:               true,
+		Credentials:                aws.AnonymousCredentials{},
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	})
+}
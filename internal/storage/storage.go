@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"iter"
 
 	"filippo.io/torchwood/prefix"
 )
@@ -15,6 +16,77 @@ type KeyStore interface {
 	Put(ctx context.Context, id string, pk []byte, version uint64) error
 }
 
+// VersionLister is implemented by KeyStore backends which can enumerate the stored versions of a key ID.
+type VersionLister interface {
+	// Versions returns the stored versions of the given key ID in ascending order.
+	Versions(ctx context.Context, id string) ([]uint64, error)
+
+	// GetVersion returns the key with the given ID and exact version, if any.
+	GetVersion(ctx context.Context, id string, version uint64) (found bool, pk []byte, err error)
+}
+
+// IDLister is implemented by KeyStore backends which can enumerate every stored key ID.
+type IDLister interface {
+	// IDs yields each key ID with at least one stored version which has not been erased.
+	IDs(ctx context.Context) iter.Seq2[string, error]
+}
+
+// Eraser is implemented by KeyStore backends which can erase stored keys.
+type Eraser interface {
+	// Erase deletes the stored key with the given ID and version, leaving a tombstone which records only the version
+	// and the key's opaque commitment. The tombstone is stored under the given pseudonym rather than anything derived
+	// from the ID, so that erased IDs can't be recovered from the store.
+	Erase(ctx context.Context, id string, version uint64, pseudonym, commitment []byte) error
+
+	// Tombstones returns the tombstones stored under the given pseudonym in ascending order of version.
+	Tombstones(ctx context.Context, pseudonym []byte) ([]Tombstone, error)
+}
+
+// Tombstone records an erased key version.
+type Tombstone struct {
+	Version    uint64
+	Commitment []byte
+}
+
 type LogStore interface {
-	Add(ctx context.Context, label, commitment []byte) error
+	// Add appends an entry containing the given label and commitment to the log, returning the index assigned to it.
+	Add(ctx context.Context, label, commitment []byte) (index uint64, err error)
+}
+
+// RootLogger is implemented by LogStore backends which can record the root hash of the prefix tree for each epoch.
+type RootLogger interface {
+	// AddRoot appends a root entry for the given root to the log, returning the index assigned to it.
+	AddRoot(ctx context.Context, root LogRoot) (index uint64, err error)
+
+	// LatestRoot returns the most recently appended root entry and its index, or nil if there are none.
+	LatestRoot(ctx context.Context) (root *LogRoot, index uint64, err error)
+}
+
+// LogIntegrator is a LogStore which can wait until an entry is covered by a signed checkpoint.
+type LogIntegrator interface {
+	// AddAndWait appends an entry containing the given label and commitment to the log, then waits until a signed
+	// checkpoint covering it has been published, returning proof of the entry's inclusion in that checkpoint.
+	AddAndWait(ctx context.Context, label, commitment []byte) (*Inclusion, error)
+
+	// Wait waits until a signed checkpoint covering the entry at the given index has been published, returning proof
+	// of the entry's inclusion in that checkpoint.
+	Wait(ctx context.Context, index uint64) (*Inclusion, error)
+}
+
+// CheckpointReader is implemented by LogStore backends which can read the log's latest checkpoint.
+type CheckpointReader interface {
+	// LatestCheckpoint returns the most recently published signed checkpoint of the log.
+	LatestCheckpoint(ctx context.Context) ([]byte, error)
+}
+
+// Inclusion is proof that an entry is included in a log.
+type Inclusion struct {
+	// Index is the index of the entry in the log.
+	Index uint64
+
+	// Checkpoint is the signed checkpoint, in note format, which covers the entry.
+	Checkpoint []byte
+
+	// Proof is the Merkle inclusion proof of the entry in the checkpoint's tree.
+	Proof [][]byte
 }
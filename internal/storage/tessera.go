@@ -2,50 +2,285 @@ package storage
 
 import (
 	"context"
-	"crypto/ed25519"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"slices"
+	"os"
+	"sync"
+	"time"
 
+	"github.com/transparency-dev/formats/log"
 	"github.com/transparency-dev/tessera"
-	"golang.org/x/mod/sumdb/note"
+	"github.com/transparency-dev/tessera/api/layout"
+	"github.com/transparency-dev/tessera/client"
 )
 
 type tesseraLog struct {
 	appender *tessera.Appender
+	reader   tessera.LogReader
+	dir      *os.Root
+
+	// mu serializes updates to the root state file.
+	mu sync.Mutex
 }
 
-func NewTesseraLog(appender *tessera.Appender) LogStore {
+// NewTesseraLog returns a LogStore which appends entries to a tessera log. It also implements RootLogger, using the
+// given reader to find the latest root entry. If dir is non-nil, the latest root entry is recorded in a file in it, so
+// that LatestRoot only reads the entries appended since it was recorded. If the appender is configured with antispam,
+// such as an FSAntispam, adding an entry identical to one already in the log returns the index of the original entry.
+func NewTesseraLog(appender *tessera.Appender, reader tessera.LogReader, dir *os.Root) LogStore {
 	return &tesseraLog{
 		appender: appender,
+		reader:   reader,
+		dir:      dir,
 	}
 }
 
-func (l *tesseraLog) Add(ctx context.Context, label, commitment []byte) error {
-	_, err := l.appender.Add(ctx, tessera.NewEntry(slices.Concat(label, commitment)))()
-	return err
+// NewIntegratingTesseraLog returns a LogStore which also implements LogIntegrator. The given reader is polled for new
+// checkpoints every pollPeriod while entries are awaiting integration, until the given context is done.
+func NewIntegratingTesseraLog(ctx context.Context, appender *tessera.Appender, reader tessera.LogReader, dir *os.Root, pollPeriod time.Duration) LogStore {
+	return &integratingTesseraLog{
+		tesseraLog: tesseraLog{appender: appender, reader: reader, dir: dir},
+		awaiter:    tessera.NewPublicationAwaiter(ctx, reader.ReadCheckpoint, pollPeriod),
+	}
 }
 
-var _ LogStore = (*tesseraLog)(nil)
+func (l *tesseraLog) Add(ctx context.Context, label, commitment []byte) (uint64, error) {
+	return l.add(ctx, KeyEntry(label, commitment))
+}
 
-func NewSigner(name string, privateKey ed25519.PrivateKey) (note.Signer, error) {
-	h := keyHash(name, append([]byte{1}, privateKey.Public().(ed25519.PublicKey)...))
-	signer, err := note.NewSigner(fmt.Sprintf("PRIVATE+KEY+%s+%08x+%s",
-		name, h, base64.StdEncoding.EncodeToString(append([]byte{1}, privateKey.Seed()...)),
-	))
+func (l *tesseraLog) AddRoot(ctx context.Context, root LogRoot) (uint64, error) {
+	entry := RootEntry(root)
+	index, err := l.add(ctx, entry)
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+
+	// No later root entry can precede this one, so the entries before it needn't be scanned again.
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	state, err := l.readRootState()
+	if err != nil {
+		return 0, err
+	}
+	if index >= state.Size {
+		if err := l.writeRootState(&rootState{Size: index + 1, Index: index, Entry: entry}); err != nil {
+			return 0, err
+		}
+	}
+	return index, nil
+}
+
+func (l *tesseraLog) add(ctx context.Context, entry []byte) (uint64, error) {
+	idx, err := l.appender.Add(ctx, tessera.NewEntry(entry))()
+	if err != nil {
+		return 0, err
+	}
+	return idx.Index, nil
+}
+
+// LatestRoot scans the entries of the log backwards for the most recent root entry, stopping at the entries which were
+// scanned when the root state was last recorded. If any entries are awaiting integration, it first waits for them to
+// be integrated, as one of them may be a root entry.
+func (l *tesseraLog) LatestRoot(ctx context.Context) (*LogRoot, uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	size, err := l.awaitIntegration(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	state, err := l.readRootState()
+	if err != nil {
+		return nil, 0, err
+	}
+	if state.Size > size {
+		return nil, 0, fmt.Errorf("storage: log has %d entries, but %d were recorded", size, state.Size)
 	}
-	return signer, nil
+
+	root, index, err := l.scanRoots(ctx, state.Size, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	if root == nil && state.Entry != nil {
+		r, err := ParseRootEntry(state.Entry)
+		if err != nil {
+			return nil, 0, fmt.Errorf("storage: %s: %w", rootStateFilename, err)
+		}
+		root, index = &r, state.Index
+	}
+
+	if size > state.Size {
+		state = rootState{Size: size}
+		if root != nil {
+			state.Index, state.Entry = index, RootEntry(*root)
+		}
+		if err := l.writeRootState(&state); err != nil {
+			return nil, 0, err
+		}
+	}
+	return root, index, nil
 }
 
-func keyHash(name string, key []byte) uint32 {
-	h := sha256.New()
-	h.Write([]byte(name))
-	h.Write([]byte("\n"))
-	h.Write(key)
-	sum := h.Sum(nil)
-	return binary.BigEndian.Uint32(sum)
+// integrationPollPeriod is how often awaitIntegration checks the size of the integrated log.
+const integrationPollPeriod = 10 * time.Millisecond
+
+// awaitIntegration waits until every entry which has been added to the log has been integrated, returning the
+// integrated size of the log.
+func (l *tesseraLog) awaitIntegration(ctx context.Context) (uint64, error) {
+	next, err := l.reader.NextIndex(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	t := time.NewTicker(integrationPollPeriod)
+	defer t.Stop()
+
+	for {
+		size, err := l.reader.IntegratedSize(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if size >= next {
+			return size, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// scanRoots scans the entries of the log from end to start backwards for the most recent root entry, returning nil if
+// there are none.
+func (l *tesseraLog) scanRoots(ctx context.Context, start, end uint64) (*LogRoot, uint64, error) {
+	size := end
+	for end > start {
+		bundleIndex := (end - 1) / layout.EntryBundleWidth
+		bundle, err := client.GetEntryBundle(ctx, l.reader.ReadEntryBundle, bundleIndex, size)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		first := bundleIndex * layout.EntryBundleWidth
+		if uint64(len(bundle.Entries)) < end-first {
+			return nil, 0, fmt.Errorf("storage: entry bundle %d has %d entries, want %d", bundleIndex, len(bundle.Entries), end-first)
+		}
+		for i := end - first; i > 0 && first+i > start; i-- {
+			if entry := bundle.Entries[i-1]; len(entry) == RootEntrySize {
+				root, err := ParseRootEntry(entry)
+				if err != nil {
+					return nil, 0, err
+				}
+				return &root, first + i - 1, nil
+			}
+		}
+		end = first
+	}
+
+	return nil, 0, nil
+}
+
+// rootStateFilename is the file in which a tesseraLog records the latest root entry.
+const rootStateFilename = "latest-root.json"
+
+// rootState records the latest root entry among the first Size entries of a log.
+type rootState struct {
+	Size  uint64
+	Index uint64
+	Entry []byte
 }
+
+// readRootState reads the recorded root state, returning a zero state if none has been recorded. The caller must hold
+// l.mu.
+func (l *tesseraLog) readRootState() (rootState, error) {
+	var state rootState
+	if l.dir == nil {
+		return state, nil
+	}
+
+	b, err := l.dir.ReadFile(rootStateFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return state, err
+	}
+
+	if err := json.Unmarshal(b, &state); err != nil {
+		return state, fmt.Errorf("storage: malformed %s: %w", rootStateFilename, err)
+	}
+	return state, nil
+}
+
+// writeRootState atomically records the given root state, if the log has a directory. The caller must hold l.mu.
+func (l *tesseraLog) writeRootState(state *rootState) error {
+	if l.dir == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(l.dir, rootStateFilename, b)
+}
+
+func (l *tesseraLog) LatestCheckpoint(ctx context.Context) ([]byte, error) {
+	return l.reader.ReadCheckpoint(ctx)
+}
+
+var (
+	_ LogStore         = (*tesseraLog)(nil)
+	_ RootLogger       = (*tesseraLog)(nil)
+	_ CheckpointReader = (*tesseraLog)(nil)
+)
+
+type integratingTesseraLog struct {
+	tesseraLog
+	awaiter *tessera.PublicationAwaiter
+}
+
+func (l *integratingTesseraLog) AddAndWait(ctx context.Context, label, commitment []byte) (*Inclusion, error) {
+	return l.await(ctx, l.appender.Add(ctx, tessera.NewEntry(KeyEntry(label, commitment))))
+}
+
+func (l *integratingTesseraLog) Wait(ctx context.Context, index uint64) (*Inclusion, error) {
+	return l.await(ctx, func() (tessera.Index, error) { return tessera.Index{Index: index}, nil })
+}
+
+// await waits for the entry at the given future index to be covered by a published checkpoint, and proves its
+// inclusion in it.
+func (l *integratingTesseraLog) await(ctx context.Context, future tessera.IndexFuture) (*Inclusion, error) {
+	idx, checkpoint, err := l.awaiter.Await(ctx, future)
+	if err != nil {
+		return nil, err
+	}
+
+	// The checkpoint's signatures are not verified here, as its size is only used to build the inclusion proof.
+	var cp log.Checkpoint
+	if _, err := cp.Unmarshal(checkpoint); err != nil {
+		return nil, fmt.Errorf("storage: parsing checkpoint: %w", err)
+	}
+
+	pb, err := client.NewProofBuilder(ctx, cp.Size, l.reader.ReadTile)
+	if err != nil {
+		return nil, err
+	}
+
+	proof, err := pb.InclusionProof(ctx, idx.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Inclusion{Index: idx.Index, Checkpoint: checkpoint, Proof: proof}, nil
+}
+
+var (
+	_ LogStore         = (*integratingTesseraLog)(nil)
+	_ RootLogger       = (*integratingTesseraLog)(nil)
+	_ LogIntegrator    = (*integratingTesseraLog)(nil)
+	_ CheckpointReader = (*integratingTesseraLog)(nil)
+)
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/tessera"
+	"github.com/transparency-dev/tessera/storage/posix"
+)
+
+func TestTesseraLogLatestRoot(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	signer, _ := newTestNoteKey(t, "KeyDonkey")
+	driver, err := posix.New(t.Context(), posix.Config{Path: filepath.Join(t.TempDir(), "log")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appender, shutdown, reader, err := tessera.NewAppender(t.Context(), driver, tessera.NewAppendOptions().
+		WithCheckpointSigner(signer).
+		WithCheckpointInterval(100*time.Millisecond).
+		WithBatching(10, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = shutdown(t.Context()) })
+
+	latest := func(dir *os.Root) (*LogRoot, uint64) {
+		t.Helper()
+
+		got, index, err := NewTesseraLog(appender, reader, dir).(RootLogger).LatestRoot(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got, index
+	}
+
+	if got, _ := latest(root); got != nil {
+		t.Errorf("LatestRoot() = %+v, want none", got)
+	}
+
+	log := NewTesseraLog(appender, reader, root)
+	if _, err := log.Add(t.Context(), []byte("label"), []byte("commitment")); err != nil {
+		t.Fatal(err)
+	}
+	want := LogRoot{Epoch: 1, Time: time.Unix(0, 22), Hash: [32]byte{1}}
+	wantIndex, err := log.(RootLogger).AddRoot(t.Context(), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Add(t.Context(), []byte("label2"), []byte("commitment")); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, dir := range map[string]*os.Root{"recorded": root, "scanned": nil} {
+		if got, index := latest(dir); got == nil || !got.Time.Equal(want.Time) || got.Epoch != want.Epoch || index != wantIndex {
+			t.Errorf("%s LatestRoot() = %+v, %d, want %+v, %d", name, got, index, want, wantIndex)
+		}
+	}
+
+	// Only the entries appended since the root state was recorded are scanned, so a recorded root is returned as-is.
+	recorded := LogRoot{Epoch: 7, Time: time.Unix(0, 22), Hash: [32]byte{7}}
+	b, err := json.Marshal(&rootState{Size: 3, Index: 2, Entry: RootEntry(recorded)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := root.WriteFile(rootStateFilename, b, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if got, index := latest(root); got == nil || got.Epoch != recorded.Epoch || index != 2 {
+		t.Errorf("LatestRoot() = %+v, %d, want epoch %d at 2", got, index, recorded.Epoch)
+	}
+
+	// Root entries appended since then are found.
+	if _, err := log.Add(t.Context(), []byte("label3"), []byte("commitment")); err != nil {
+		t.Fatal(err)
+	}
+	scanned := LogRoot{Epoch: 8, Time: time.Unix(0, 22), Hash: [32]byte{8}}
+	index, err := NewTesseraLog(appender, reader, nil).(RootLogger).AddRoot(t.Context(), scanned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, gotIndex := latest(root); got == nil || got.Epoch != scanned.Epoch || gotIndex != index {
+		t.Errorf("LatestRoot() = %+v, %d, want epoch %d at %d", got, gotIndex, scanned.Epoch, index)
+	}
+
+	// Entries awaiting integration are waited for, as one of them may be a root entry.
+	pending := &pendingLogReader{LogReader: reader, polls: 3}
+	got, gotIndex, err := NewTesseraLog(appender, pending, nil).(RootLogger).LatestRoot(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Epoch != scanned.Epoch || gotIndex != index {
+		t.Errorf("LatestRoot() = %+v, %d, want epoch %d at %d", got, gotIndex, scanned.Epoch, index)
+	}
+	if pending.polls != 0 {
+		t.Errorf("LatestRoot() returned with %d polls remaining", pending.polls)
+	}
+}
+
+// pendingLogReader reports the last entry of the log as awaiting integration for the given number of polls.
+type pendingLogReader struct {
+	tessera.LogReader
+	polls int
+}
+
+func (r *pendingLogReader) IntegratedSize(ctx context.Context) (uint64, error) {
+	size, err := r.LogReader.IntegratedSize(ctx)
+	if err != nil || r.polls == 0 {
+		return size, err
+	}
+	r.polls--
+	return size - 1, nil
+}
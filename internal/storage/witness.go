@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+
+	fnote "github.com/transparency-dev/formats/note"
+	"github.com/transparency-dev/tessera"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// Witness is a witness which implements the C2SP tlog-witness protocol, and cosigns the log's checkpoints once it has
+// verified that they are consistent with the checkpoints it has previously cosigned.
+type Witness struct {
+	// VKey is the witness's Ed25519 verifier key, in note format.
+	VKey string
+
+	// URL is the witness's submission prefix, to which the add-checkpoint path is appended.
+	URL string
+}
+
+// NewWitnessGroup returns a group of witnesses which is satisfied when at least threshold of them have cosigned a
+// checkpoint. The group is passed to tessera.AppendOptions.WithWitnesses, after which the log only publishes
+// checkpoints which carry the witnesses' cosignatures.
+func NewWitnessGroup(threshold int, witnesses ...Witness) (tessera.WitnessGroup, error) {
+	if threshold < 0 || threshold > len(witnesses) {
+		return tessera.WitnessGroup{}, fmt.Errorf("storage: witness threshold %d out of range for %d witnesses", threshold, len(witnesses))
+	}
+
+	group := tessera.WitnessGroup{N: threshold}
+	for _, w := range witnesses {
+		u, err := url.Parse(w.URL)
+		if err != nil {
+			return tessera.WitnessGroup{}, fmt.Errorf("storage: witness URL: %w", err)
+		}
+
+		witness, err := tessera.NewWitness(w.VKey, u)
+		if err != nil {
+			return tessera.WitnessGroup{}, fmt.Errorf("storage: witness %q: %w", w.VKey, err)
+		}
+		group.Components = append(group.Components, witness)
+	}
+
+	return group, nil
+}
+
+// NewWitnessVerifier returns a verifier for the cosignatures of the witness with the given Ed25519 verifier key.
+// Witnesses cosign checkpoints with timestamped cosignature/v1 signatures, which the key's standard verifier does not
+// accept.
+func NewWitnessVerifier(vkey string) (note.Verifier, error) {
+	return fnote.NewVerifierForCosignatureV1(vkey)
+}
@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/formats/log"
+	fnote "github.com/transparency-dev/formats/note"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/tessera"
+	"github.com/transparency-dev/tessera/storage/posix"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestWitnesses(t *testing.T) {
+	logSigner, logVerifier := newTestNoteKey(t, "KeyDonkey")
+
+	var witnesses []Witness
+	var verifiers []note.Verifier
+	var standIns []*testWitness
+	for i := range 2 {
+		skey, vkey, err := note.GenerateKey(rand.Reader, fmt.Sprintf("witness%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cosigner, err := fnote.NewSignerForCosignatureV1(skey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier, err := NewWitnessVerifier(vkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := &testWitness{signer: cosigner, logVerifier: logVerifier}
+		server := httptest.NewServer(w)
+		t.Cleanup(server.Close)
+
+		witnesses = append(witnesses, Witness{VKey: vkey, URL: server.URL})
+		verifiers = append(verifiers, verifier)
+		standIns = append(standIns, w)
+	}
+
+	group, err := NewWitnessGroup(2, witnesses...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewWitnessGroup(3, witnesses...); err == nil {
+		t.Error("created witness group with unreachable threshold")
+	}
+
+	// Open the log and a fork of it, signed with the same key. Both start out empty, so the witnesses cosign both of
+	// their initial checkpoints.
+	honest := newTestWitnessedLog(t, filepath.Join(t.TempDir(), "log"), logSigner, group)
+	fork := newTestWitnessedLog(t, filepath.Join(t.TempDir(), "log"), logSigner, group)
+
+	// Each checkpoint of the log must be cosigned by both witnesses.
+	for i := range 3 {
+		inclusion, err := honest.(LogIntegrator).AddAndWait(t.Context(), []byte{byte(i)}, []byte("honest"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := note.Open(inclusion.Checkpoint, note.VerifierList(append([]note.Verifier{logVerifier}, verifiers...)...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(n.Sigs), 3; got != want {
+			t.Errorf("checkpoint has %d verified signatures, want %d", got, want)
+		}
+	}
+
+	// Once the fork diverges from the cosigned checkpoints, its checkpoints must not be cosigned or published.
+	for i := range 3 {
+		if _, err := fork.Add(t.Context(), []byte{byte(i)}, []byte("forked")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	if _, err := fork.(LogIntegrator).AddAndWait(ctx, []byte{3}, []byte("forked")); err == nil {
+		t.Fatal("fork of the log was published")
+	}
+
+	for i, w := range standIns {
+		if w.Refused() == 0 {
+			t.Errorf("witness %d did not refuse the fork", i)
+		}
+	}
+}
+
+func newTestNoteKey(t *testing.T, name string) (note.Signer, note.Verifier) {
+	t.Helper()
+
+	skey, vkey, err := note.GenerateKey(rand.Reader, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, verifier
+}
+
+func newTestWitnessedLog(t *testing.T, dir string, signer note.Signer, group tessera.WitnessGroup) LogStore {
+	t.Helper()
+
+	driver, err := posix.New(t.Context(), posix.Config{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appender, shutdown, reader, err := tessera.NewAppender(t.Context(), driver, tessera.NewAppendOptions().
+		WithCheckpointSigner(signer).
+		WithCheckpointInterval(100*time.Millisecond).
+		WithBatching(10, 10*time.Millisecond).
+		WithWitnesses(group, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := shutdown(t.Context()); err != nil {
+			t.Log(err)
+		}
+	})
+
+	return NewIntegratingTesseraLog(t.Context(), appender, reader, nil, 10*time.Millisecond)
+}
+
+// testWitness is a stand-in for a witness which implements the add-checkpoint endpoint of the C2SP tlog-witness
+// protocol for a single log.
+type testWitness struct {
+	signer      note.Signer
+	logVerifier note.Verifier
+
+	mu      sync.Mutex
+	size    uint64
+	hash    []byte
+	refused int
+}
+
+func (w *testWitness) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost || req.URL.Path != "/add-checkpoint" {
+		http.NotFound(rw, req)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The request is the old size, the consistency proof, and an empty line, followed by the checkpoint.
+	header, signed, ok := bytes.Cut(body, []byte("\n\n"))
+	if !ok {
+		http.Error(rw, "malformed request", http.StatusBadRequest)
+		return
+	}
+	lines := strings.Split(string(header), "\n")
+	oldSize, err := strconv.ParseUint(strings.TrimPrefix(lines[0], "old "), 10, 64)
+	if err != nil || !strings.HasPrefix(lines[0], "old ") {
+		http.Error(rw, "malformed old size", http.StatusBadRequest)
+		return
+	}
+	var consistency [][]byte
+	for _, line := range lines[1:] {
+		h, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			http.Error(rw, "malformed proof", http.StatusBadRequest)
+			return
+		}
+		consistency = append(consistency, h)
+	}
+
+	n, err := note.Open(signed, note.VerifierList(w.logVerifier))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusForbidden)
+		return
+	}
+	var cp log.Checkpoint
+	if _, err := cp.Unmarshal([]byte(n.Text)); err != nil || cp.Origin != w.logVerifier.Name() {
+		http.Error(rw, "unknown origin", http.StatusNotFound)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch {
+	case oldSize > cp.Size:
+		http.Error(rw, "old size is larger than checkpoint size", http.StatusBadRequest)
+		return
+	case oldSize != w.size:
+		rw.Header().Set("Content-Type", "text/x.tlog.size")
+		rw.WriteHeader(http.StatusConflict)
+		_, _ = fmt.Fprintf(rw, "%d\n", w.size)
+		return
+	case oldSize == cp.Size && w.hash != nil && !bytes.Equal(w.hash, cp.Hash):
+		w.refused++
+		http.Error(rw, "root hash does not match", http.StatusConflict)
+		return
+	case oldSize > 0 && oldSize < cp.Size:
+		if err := proof.VerifyConsistency(rfc6962.DefaultHasher, oldSize, cp.Size, consistency, w.hash, cp.Hash); err != nil {
+			w.refused++
+			http.Error(rw, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	cosigned, err := note.Sign(&note.Note{Text: n.Text}, w.signer)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.size, w.hash = cp.Size, cp.Hash
+
+	// Respond with the cosignature lines alone.
+	_, sigs, _ := bytes.Cut(cosigned, []byte("\n\n"))
+	_, _ = rw.Write(sigs)
+}
+
+// Refused returns the number of checkpoints the witness has refused as inconsistent.
+func (w *testWitness) Refused() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.refused
+}
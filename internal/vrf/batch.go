@@ -0,0 +1,69 @@
+package vrf
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// BatchError is returned by VerifyBatch when one or more proofs are invalid. It wraps ErrInvalidProof.
+type BatchError struct {
+	// Invalid contains the indexes of the invalid proofs, in ascending order.
+	Invalid []int
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("vrf: %d invalid proofs in batch", len(e.Invalid))
+}
+
+func (e *BatchError) Unwrap() error {
+	return ErrInvalidProof
+}
+
+// minBatchChunk is the smallest number of proofs which VerifyBatch verifies on a separate goroutine.
+const minBatchChunk = 16
+
+// VerifyBatch verifies each of the given RFC 9381 proofs of the corresponding input, as created by Prove, returning the
+// hash of each proof. If any proofs are invalid, their hashes are nil and a *BatchError listing them is returned.
+//
+// An RFC 9381 proof contains the challenge c rather than the points U and V from which it is hashed, so the
+// verification equations of a batch can't be combined into a single check: U and V must be recomputed for each proof
+// to check its challenge. Instead, chunks of the batch are verified in parallel, so verification scales with
+// GOMAXPROCS.
+func (vk *VerifyingKey) VerifyBatch(alphas, proofs [][]byte) (hashes [][]byte, err error) {
+	if len(alphas) != len(proofs) {
+		return nil, errors.New("vrf: mismatched number of inputs and proofs")
+	}
+
+	hashes = make([][]byte, len(proofs))
+	verify := func(start, end int) {
+		for i := start; i < end; i++ {
+			hashes[i], _ = vk.Verify(alphas[i], proofs[i])
+		}
+	}
+
+	workers := min(runtime.GOMAXPROCS(0), (len(proofs)+minBatchChunk-1)/minBatchChunk)
+	if workers <= 1 {
+		verify(0, len(proofs))
+	} else {
+		var wg sync.WaitGroup
+		size := (len(proofs) + workers - 1) / workers
+		for start := 0; start < len(proofs); start += size {
+			wg.Go(func() { verify(start, min(start+size, len(proofs))) })
+		}
+		wg.Wait()
+	}
+
+	// Invalid proofs are identified by their missing hashes.
+	var invalid []int
+	for i, hash := range hashes {
+		if hash == nil {
+			invalid = append(invalid, i)
+		}
+	}
+	if len(invalid) > 0 {
+		return hashes, &BatchError{Invalid: invalid}
+	}
+	return hashes, nil
+}
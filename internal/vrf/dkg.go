@@ -0,0 +1,334 @@
+package vrf
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"filippo.io/edwards25519"
+)
+
+// ErrTranscriptMismatch is returned by DKG.Finish when another participant received different key generation
+// commitments.
+var ErrTranscriptMismatch = errors.New("vrf: key generation transcripts differ")
+
+// DKG is a participant in the distributed generation of a threshold key, which creates a key without a dealer. It
+// uses Pedersen's protocol with Feldman's verifiable secret sharing, and proofs of possession of each participant's
+// secret, as in FROST's key generation:
+//
+//  1. The participants agree on a unique session identifier, such as a random value chosen by one of them. Each
+//     participant calls NewDKG with it and sends the resulting DKGCommitment to every other participant.
+//  2. Once it has every participant's commitment, each participant calls DKG.Shares, and sends each resulting DKGShare
+//     to the participant it is addressed to over a private, authenticated channel. It also sends the confirmation
+//     returned by DKG.Confirmation to every other participant over an authenticated channel.
+//  3. Once it has a share and a confirmation from every other participant, each participant calls DKG.Finish to create
+//     its KeyShare.
+//
+// The protocol requires every participant to receive the same commitments. Rather than relying on a broadcast channel,
+// the confirmations let each participant check that every other participant received the commitments it did, so that
+// a participant which sends different commitments to different participants is detected.
+type DKG struct {
+	id, threshold, n int
+	suite            Suite
+	session          []byte
+	coeffs           []*edwards25519.Scalar
+	commitment       *DKGCommitment
+}
+
+// NewDKG begins the generation of a threshold key by the participant with the given ID, from 1 to n, in the session
+// with the given identifier. Returns the participant's state and its commitment, which must be sent to every other
+// participant.
+func NewDKG(session []byte, id, threshold, n int, opts ...Option) (*DKG, *DKGCommitment, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkThreshold(threshold, n); err != nil {
+		return nil, nil, err
+	}
+	if id < 1 || id > n {
+		return nil, nil, fmt.Errorf("vrf: invalid participant ID %d", id)
+	}
+
+	// Commit to the coefficients of a random polynomial of degree threshold-1.
+	d := &DKG{
+		id:        id,
+		threshold: threshold,
+		n:         n,
+		suite:     o.suite,
+		session:   slices.Clone(session),
+		coeffs:    make([]*edwards25519.Scalar, threshold),
+	}
+	c := &DKGCommitment{id: id, coeffs: make([]*edwards25519.Point, threshold)}
+	for i := range d.coeffs {
+		d.coeffs[i] = randomScalar()
+		c.coeffs[i] = new(edwards25519.Point).ScalarBaseMult(d.coeffs[i])
+	}
+
+	// Prove possession of the constant term, so that no participant can choose its commitment to cancel out the others.
+	k := hedgedNonce(d.coeffs[0], c.coeffs[0])
+	c.r = new(edwards25519.Point).ScalarBaseMult(k)
+	c.mu = new(edwards25519.Scalar).MultiplyAdd(d.dkgChallenge(id, c.coeffs[0], c.r), d.coeffs[0], k)
+
+	d.commitment = c
+	return d, c, nil
+}
+
+// Shares checks the commitments of every participant, in ascending order of ID, and returns the participant's secret
+// shares for each of the other participants.
+func (d *DKG) Shares(commitments []*DKGCommitment) ([]*DKGShare, error) {
+	if d.coeffs == nil {
+		return nil, errors.New("vrf: key generation already finished")
+	}
+	if err := d.checkCommitments(commitments); err != nil {
+		return nil, err
+	}
+
+	shares := make([]*DKGShare, 0, d.n-1)
+	for j := 1; j <= d.n; j++ {
+		if j != d.id {
+			shares = append(shares, &DKGShare{from: d.id, to: j, value: evalPolynomial(d.coeffs, j)})
+		}
+	}
+	return shares, nil
+}
+
+// Confirmation checks the commitments of every participant, in ascending order of ID, and returns a hash of the
+// session's transcript, which must be sent to every other participant.
+func (d *DKG) Confirmation(commitments []*DKGCommitment) ([]byte, error) {
+	if err := d.checkCommitments(commitments); err != nil {
+		return nil, err
+	}
+	return d.transcriptHash(commitments), nil
+}
+
+// Finish checks the confirmations sent to the participant by every other participant against its own, checks the
+// shares sent to it against their senders' commitments, and returns the participant's share of the threshold key. The
+// participant's state is erased.
+func (d *DKG) Finish(commitments []*DKGCommitment, shares []*DKGShare, confirmations [][]byte) (*KeyShare, error) {
+	if d.coeffs == nil {
+		return nil, errors.New("vrf: key generation already finished")
+	}
+	if err := d.checkCommitments(commitments); err != nil {
+		return nil, err
+	}
+	if len(shares) != d.n-1 {
+		return nil, fmt.Errorf("vrf: %d key generation shares, want %d", len(shares), d.n-1)
+	}
+	if len(confirmations) != d.n-1 {
+		return nil, fmt.Errorf("vrf: %d key generation confirmations, want %d", len(confirmations), d.n-1)
+	}
+
+	// If any participant received different commitments, the key generation must be abandoned.
+	transcript := d.transcriptHash(commitments)
+	for _, c := range confirmations {
+		if !bytes.Equal(c, transcript) {
+			return nil, ErrTranscriptMismatch
+		}
+	}
+
+	// The participant's secret share is the sum of every participant's polynomial at its ID.
+	x := evalPolynomial(d.coeffs, d.id)
+	for _, c := range commitments {
+		if c.id == d.id {
+			continue
+		}
+
+		j := slices.IndexFunc(shares, func(s *DKGShare) bool { return s.from == c.id })
+		if j < 0 || shares[j].to != d.id {
+			return nil, fmt.Errorf("vrf: missing key generation share from participant %d", c.id)
+		}
+
+		if new(edwards25519.Point).ScalarBaseMult(shares[j].value).Equal(evalCommitment(c.coeffs, d.id)) != 1 {
+			return nil, fmt.Errorf("%w: key generation share from participant %d", ErrInvalidShare, c.id)
+		}
+		x.Add(x, shares[j].value)
+	}
+
+	// The public key and the verification shares are the sums of every participant's committed polynomial at zero
+	// and at each ID.
+	y := edwards25519.NewIdentityPoint()
+	for _, c := range commitments {
+		y.Add(y, c.coeffs[0])
+	}
+
+	vk, err := NewVerifyingKey(y.Bytes(), WithSuite(d.suite), WithStrictKey())
+	if err != nil {
+		return nil, err
+	}
+
+	tk := &ThresholdKey{vk: vk, threshold: d.threshold, shares: make([]*edwards25519.Point, d.n)}
+	for i := range tk.shares {
+		tk.shares[i] = edwards25519.NewIdentityPoint()
+		for _, c := range commitments {
+			tk.shares[i].Add(tk.shares[i], evalCommitment(c.coeffs, i+1))
+		}
+	}
+
+	d.coeffs = nil
+	return &KeyShare{id: d.id, x: x, tk: tk}, nil
+}
+
+// checkCommitments checks that there is a valid commitment from every participant, in ascending order of ID, and
+// that the participant's own commitment is unchanged.
+func (d *DKG) checkCommitments(commitments []*DKGCommitment) error {
+	if len(commitments) != d.n {
+		return fmt.Errorf("vrf: %d key generation commitments, want %d", len(commitments), d.n)
+	}
+
+	for i, c := range commitments {
+		if c.id != i+1 || len(c.coeffs) != d.threshold {
+			return fmt.Errorf("%w: key generation commitment %d", ErrInvalidShare, i+1)
+		}
+
+		if c.id == d.id {
+			if !slices.EqualFunc(c.coeffs, d.commitment.coeffs, func(a, b *edwards25519.Point) bool {
+				return a.Equal(b) == 1
+			}) {
+				return errors.New("vrf: participant's key generation commitment has changed")
+			}
+			continue
+		}
+
+		// mu*B - c*C_0 = R, if the participant knows the constant term of its polynomial.
+		negC := new(edwards25519.Scalar).Negate(d.dkgChallenge(c.id, c.coeffs[0], c.r))
+		if new(edwards25519.Point).VarTimeDoubleScalarBaseMult(negC, c.coeffs[0], c.mu).Equal(c.r) != 1 {
+			return fmt.Errorf("%w: key generation commitment from participant %d", ErrInvalidShare, c.id)
+		}
+	}
+
+	return nil
+}
+
+// dkgChallenge returns the challenge of a participant's proof of possession of its constant term, which is bound to
+// the session so that a proof can't be replayed in another session.
+func (d *DKG) dkgChallenge(id int, c0, r *edwards25519.Point) *edwards25519.Scalar {
+	return hashToScalar([]byte("keydonkey threshold ECVRF key generation"), d.context(), []byte{byte(id)}, c0.Bytes(),
+		r.Bytes())
+}
+
+// transcriptHash returns a hash of the session's parameters and every participant's commitment.
+func (d *DKG) transcriptHash(commitments []*DKGCommitment) []byte {
+	h := sha512.New()
+	h.Write([]byte("keydonkey threshold ECVRF key generation transcript"))
+	h.Write(d.context())
+	for _, c := range commitments {
+		b, _ := c.MarshalBinary()
+		h.Write(b)
+	}
+	return h.Sum(nil)
+}
+
+// context returns an encoding of the session's identifier and parameters.
+func (d *DKG) context() []byte {
+	b := []byte{byte(d.suite), byte(d.threshold), byte(d.n)}
+	b = binary.BigEndian.AppendUint32(b, uint32(len(d.session)))
+	return append(b, d.session...)
+}
+
+// evalCommitment returns the value at x of the polynomial committed to by the given points, multiplied by the base
+// point.
+func evalCommitment(coeffs []*edwards25519.Point, x int) *edwards25519.Point {
+	powers := make([]*edwards25519.Scalar, len(coeffs))
+	powers[0] = scalarFromInt(1)
+	xs := scalarFromInt(x)
+	for i := 1; i < len(powers); i++ {
+		powers[i] = new(edwards25519.Scalar).Multiply(powers[i-1], xs)
+	}
+	return new(edwards25519.Point).VarTimeMultiScalarMult(powers, coeffs)
+}
+
+// DKGCommitment is a participant's public commitment to its polynomial, which must be sent to every other participant.
+type DKGCommitment struct {
+	id     int
+	coeffs []*edwards25519.Point
+	r      *edwards25519.Point
+	mu     *edwards25519.Scalar
+}
+
+// ID returns the participant's identifier.
+func (c *DKGCommitment) ID() int {
+	return c.id
+}
+
+func (c *DKGCommitment) MarshalBinary() (data []byte, err error) {
+	if c.r == nil {
+		return nil, errors.New("vrf: uninitialized key generation commitment")
+	}
+
+	b := make([]byte, 0, 65+32*len(c.coeffs))
+	b = append(b, byte(c.id))
+	b = append(b, c.r.Bytes()...)
+	b = append(b, c.mu.Bytes()...)
+	for _, p := range c.coeffs {
+		b = append(b, p.Bytes()...)
+	}
+	return b, nil
+}
+
+func (c *DKGCommitment) UnmarshalBinary(data []byte) error {
+	if len(data) < 65+2*32 || (len(data)-65)%32 != 0 || data[0] == 0 {
+		return errors.New("vrf: invalid key generation commitment")
+	}
+
+	r, ok := decodePoint(data[1:33])
+	if !ok {
+		return errors.New("vrf: invalid key generation commitment")
+	}
+
+	mu, err := new(edwards25519.Scalar).SetCanonicalBytes(data[33:65])
+	if err != nil {
+		return err
+	}
+
+	coeffs := make([]*edwards25519.Point, (len(data)-65)/32)
+	for i := range coeffs {
+		if coeffs[i], ok = decodePoint(data[65+32*i : 97+32*i]); !ok {
+			return errors.New("vrf: invalid key generation commitment")
+		}
+	}
+
+	*c = DKGCommitment{id: int(data[0]), coeffs: coeffs, r: r, mu: mu}
+	return nil
+}
+
+// DKGShare is a participant's secret share for another participant, which must only be sent to that participant.
+type DKGShare struct {
+	from, to int
+	value    *edwards25519.Scalar
+}
+
+// From returns the identifier of the participant which created the share.
+func (s *DKGShare) From() int {
+	return s.from
+}
+
+// To returns the identifier of the participant to which the share must be sent.
+func (s *DKGShare) To() int {
+	return s.to
+}
+
+func (s *DKGShare) MarshalBinary() (data []byte, err error) {
+	if s.value == nil {
+		return nil, errors.New("vrf: uninitialized key generation share")
+	}
+	return append([]byte{byte(s.from), byte(s.to)}, s.value.Bytes()...), nil
+}
+
+func (s *DKGShare) UnmarshalBinary(data []byte) error {
+	if len(data) != 34 || data[0] == 0 || data[1] == 0 {
+		return errors.New("vrf: invalid key generation share")
+	}
+
+	value, err := new(edwards25519.Scalar).SetCanonicalBytes(data[2:])
+	if err != nil {
+		return err
+	}
+
+	*s = DKGShare{from: int(data[0]), to: int(data[1]), value: value}
+	return nil
+}
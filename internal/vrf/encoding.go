@@ -0,0 +1,286 @@
+package vrf
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+)
+
+// Keys are encoded in the standard containers for Ed25519 keys: PKIX and PKCS #8 (RFC 8410), in DER or PEM, and JWK
+// (RFC 8037). There are no standard identifiers for the ECVRF suites, so PEM blocks record a key's suite in a "Suite"
+// header and JWKs record it in a private "ecvrf_suite" member, both as returned by Suite.String. The registered "alg"
+// member isn't used, as it names a JOSE algorithm and ECVRF has none. DER encodings don't record the suite. When
+// parsing, a recorded suite overrides any WithSuite option; otherwise, the suite is chosen by the options.
+//
+// Private keys are encoded as the Ed25519 private keys from which proving keys are derived, rather than as proving
+// keys, so that a proving key never retains its seed. Callers should clear a private key once they have derived what
+// they need from it.
+
+// pemSuiteHeader is the PEM header which records a key's suite.
+const pemSuiteHeader = "Suite"
+
+// MarshalPKIX returns the PKIX, ASN.1 DER encoding of the key, which doesn't record its suite.
+func (vk *VerifyingKey) MarshalPKIX() ([]byte, error) {
+	return x509.MarshalPKIXPublicKey(ed25519.PublicKey(vk.encoded))
+}
+
+// ParsePKIXVerifyingKey parses a PKIX, ASN.1 DER encoded Ed25519 public key.
+func ParsePKIXVerifyingKey(der []byte, opts ...Option) (*VerifyingKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("vrf: PKIX key is a %T, not an Ed25519 public key", key)
+	}
+	return NewVerifyingKey(publicKey, opts...)
+}
+
+// MarshalPEM returns the key's PKIX encoding in a "PUBLIC KEY" PEM block, which records its suite.
+func (vk *VerifyingKey) MarshalPEM() ([]byte, error) {
+	der, err := vk.MarshalPKIX()
+	if err != nil {
+		return nil, err
+	}
+	return marshalPEM("PUBLIC KEY", vk.suite, der), nil
+}
+
+// ParsePEMVerifyingKey parses an Ed25519 public key from the first "PUBLIC KEY" PEM block in the given data.
+func ParsePEMVerifyingKey(data []byte, opts ...Option) (*VerifyingKey, error) {
+	der, opts, err := parsePEM(data, "PUBLIC KEY", opts)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePKIXVerifyingKey(der, opts...)
+}
+
+// MarshalJWK returns the key as an Ed25519 JWK, which records its suite.
+func (vk *VerifyingKey) MarshalJWK() ([]byte, error) {
+	return json.Marshal(&jwk{
+		KeyType: "OKP",
+		Curve:   "Ed25519",
+		Suite:   vk.suite.String(),
+		X:       base64.RawURLEncoding.EncodeToString(vk.encoded),
+	})
+}
+
+// ParseJWKVerifyingKey parses an Ed25519 public key from the given JWK. Any private key in the JWK is ignored.
+func ParseJWKVerifyingKey(data []byte, opts ...Option) (*VerifyingKey, error) {
+	k, opts, err := parseJWK(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewVerifyingKey(k.x, opts...)
+}
+
+// MarshalPEMPrivateKey returns the PKCS #8 encoding of the given Ed25519 private key in a "PRIVATE KEY" PEM block,
+// which records the given suite.
+func MarshalPEMPrivateKey(privateKey ed25519.PrivateKey, suite Suite) ([]byte, error) {
+	if err := checkPrivateKey(privateKey, suite); err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(der)
+
+	return marshalPEM("PRIVATE KEY", suite, der), nil
+}
+
+// ParsePKCS8PrivateKey parses a PKCS #8, ASN.1 DER encoded Ed25519 private key and returns it with the suite chosen
+// by the options.
+func ParsePKCS8PrivateKey(der []byte, opts ...Option) (ed25519.PrivateKey, Suite, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, 0, fmt.Errorf("vrf: PKCS #8 key is a %T, not an Ed25519 private key", key)
+	}
+	return privateKey, o.suite, nil
+}
+
+// ParsePEMPrivateKey parses an Ed25519 private key and its suite from the first "PRIVATE KEY" PEM block in the given
+// data.
+func ParsePEMPrivateKey(data []byte, opts ...Option) (ed25519.PrivateKey, Suite, error) {
+	der, opts, err := parsePEM(data, "PRIVATE KEY", opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ParsePKCS8PrivateKey(der, opts...)
+}
+
+// MarshalJWKPrivateKey returns the given Ed25519 private key as a JWK containing both the private and public keys,
+// which records the given suite.
+func MarshalJWKPrivateKey(privateKey ed25519.PrivateKey, suite Suite) ([]byte, error) {
+	if err := checkPrivateKey(privateKey, suite); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&jwk{
+		KeyType: "OKP",
+		Curve:   "Ed25519",
+		Suite:   suite.String(),
+		X:       base64.RawURLEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey)),
+		D:       base64.RawURLEncoding.EncodeToString(privateKey.Seed()),
+	})
+}
+
+// ParseJWKPrivateKey parses an Ed25519 private key and its suite from the given JWK. The JWK's public key must match
+// its private key.
+func ParseJWKPrivateKey(data []byte, opts ...Option) (ed25519.PrivateKey, Suite, error) {
+	k, opts, err := parseJWK(data, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer clear(k.d)
+
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(k.d) != ed25519.SeedSize {
+		return nil, 0, errors.New("vrf: JWK does not contain an Ed25519 private key")
+	}
+
+	privateKey := ed25519.NewKeyFromSeed(k.d)
+	if !bytes.Equal(privateKey.Public().(ed25519.PublicKey), k.x) {
+		clear(privateKey)
+		return nil, 0, errors.New("vrf: JWK public key does not match its private key")
+	}
+	return privateKey, o.suite, nil
+}
+
+// LoadPrivateKey reads an Ed25519 private key and its suite from the PEM or JWK file at the given path. On Unix
+// systems, the file must be a regular file which can't be accessed by the owner's group or by others.
+func LoadPrivateKey(path string, opts ...Option) (ed25519.PrivateKey, Suite, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, 0, fmt.Errorf("vrf: %s is not a regular file", path)
+	}
+	if perm := info.Mode().Perm(); runtime.GOOS != "windows" && perm&0o077 != 0 {
+		return nil, 0, fmt.Errorf("vrf: %s has permissions %#o, which allow access by other users", path, perm)
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer clear(data)
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return ParseJWKPrivateKey(trimmed, opts...)
+	}
+	return ParsePEMPrivateKey(data, opts...)
+}
+
+// checkPrivateKey returns an error if the given private key or suite is invalid.
+func checkPrivateKey(privateKey ed25519.PrivateKey, suite Suite) error {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return errors.New("vrf: invalid Ed25519 private key")
+	}
+	if suite != TAI && suite != ELL2 {
+		return fmt.Errorf("vrf: unknown suite %v", suite)
+	}
+	return nil
+}
+
+func marshalPEM(blockType string, suite Suite, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:    blockType,
+		Headers: map[string]string{pemSuiteHeader: suite.String()},
+		Bytes:   der,
+	})
+}
+
+// parsePEM returns the contents of the first PEM block of the given type in the given data, and the given options
+// with the block's suite, if it records one.
+func parsePEM(data []byte, blockType string, opts []Option) ([]byte, []Option, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, nil, fmt.Errorf("vrf: no %s PEM block found", blockType)
+		}
+		if block.Type != blockType {
+			continue
+		}
+
+		if name, ok := block.Headers[pemSuiteHeader]; ok {
+			suite, err := ParseSuite(name)
+			if err != nil {
+				return nil, nil, err
+			}
+			opts = append(slices.Clone(opts), WithSuite(suite))
+		}
+		return block.Bytes, opts, nil
+	}
+}
+
+// jwk is an Ed25519 JSON Web Key, as specified by RFC 8037.
+type jwk struct {
+	KeyType string `json:"kty"`
+	Curve   string `json:"crv"`
+	Suite   string `json:"ecvrf_suite,omitempty"`
+	X       string `json:"x"`
+	D       string `json:"d,omitempty"`
+
+	x, d []byte
+}
+
+// parseJWK decodes an Ed25519 JWK, returning it and the given options with the JWK's suite, if it records one.
+func parseJWK(data []byte, opts []Option) (*jwk, []Option, error) {
+	var k jwk
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, nil, err
+	}
+	if k.KeyType != "OKP" || k.Curve != "Ed25519" {
+		return nil, nil, fmt.Errorf("vrf: JWK is a %s %s key, not an Ed25519 key", k.KeyType, k.Curve)
+	}
+
+	var err error
+	if k.x, err = base64.RawURLEncoding.DecodeString(k.X); err != nil {
+		return nil, nil, fmt.Errorf("vrf: invalid JWK public key: %w", err)
+	}
+	if k.d, err = base64.RawURLEncoding.DecodeString(k.D); err != nil {
+		return nil, nil, fmt.Errorf("vrf: invalid JWK private key: %w", err)
+	}
+
+	if k.Suite != "" {
+		suite, err := ParseSuite(k.Suite)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(slices.Clone(opts), WithSuite(suite))
+	}
+	return &k, opts, nil
+}
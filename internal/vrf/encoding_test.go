@@ -0,0 +1,166 @@
+package vrf
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestKeyEncodings(t *testing.T) {
+	privateKey := ed25519.NewKeyFromSeed(testVectors[0].SK)
+
+	for _, suite := range []Suite{TAI, ELL2} {
+		t.Run(suite.String(), func(t *testing.T) {
+			sk := NewProvingKey(privateKey, WithSuite(suite))
+			vk := &sk.VerifyingKey
+
+			for name, f := range map[string]struct {
+				marshal func() ([]byte, error)
+				parse   func([]byte, ...Option) (*VerifyingKey, error)
+				suite   Suite
+			}{
+				"PKIX": {vk.MarshalPKIX, ParsePKIXVerifyingKey, ELL2},
+				"PEM":  {vk.MarshalPEM, ParsePEMVerifyingKey, suite},
+				"JWK":  {vk.MarshalJWK, ParseJWKVerifyingKey, suite},
+			} {
+				t.Run("verifying key/"+name, func(t *testing.T) {
+					b, err := f.marshal()
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					got, err := f.parse(b)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(got.encoded, vk.encoded) || got.Suite() != f.suite {
+						t.Errorf("parsed %x (%v), want %x (%v)", got.encoded, got.Suite(), vk.encoded, f.suite)
+					}
+				})
+			}
+
+			for name, f := range map[string]struct {
+				marshal func(ed25519.PrivateKey, Suite) ([]byte, error)
+				parse   func([]byte, ...Option) (ed25519.PrivateKey, Suite, error)
+				suite   Suite
+			}{
+				"PKCS8": {marshalPKCS8, ParsePKCS8PrivateKey, ELL2},
+				"PEM":   {MarshalPEMPrivateKey, ParsePEMPrivateKey, suite},
+				"JWK":   {MarshalJWKPrivateKey, ParseJWKPrivateKey, suite},
+			} {
+				t.Run("private key/"+name, func(t *testing.T) {
+					b, err := f.marshal(privateKey, suite)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					got, gotSuite, err := f.parse(b)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !got.Equal(privateKey) || gotSuite != f.suite {
+						t.Errorf("parsed a key with suite %v, want the original key with suite %v", gotSuite, f.suite)
+					}
+				})
+			}
+		})
+	}
+
+	// Invalid private keys are rejected rather than encoded.
+	for _, marshal := range []func(ed25519.PrivateKey, Suite) ([]byte, error){MarshalPEMPrivateKey, MarshalJWKPrivateKey} {
+		if _, err := marshal(nil, ELL2); err == nil {
+			t.Error("encoded an empty private key")
+		}
+		if _, err := marshal(privateKey, 0); err == nil {
+			t.Error("encoded a private key with an unknown suite")
+		}
+	}
+
+	// Keys encoded by other tools, which don't record a suite, use the suite given by the options.
+	der, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vk, err := ParsePEMVerifyingKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), WithSuite(TAI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := vk.Suite(), TAI; got != want {
+		t.Errorf("Suite() = %v, want %v", got, want)
+	}
+
+	for name, jwk := range map[string]string{
+		"wrong curve":      `{"kty":"OKP","crv":"X25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`,
+		"unknown suite":    `{"kty":"OKP","crv":"Ed25519","ecvrf_suite":"EdDSA","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`,
+		"no private key":   `{"kty":"OKP","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`,
+		"mismatched keys":  `{"kty":"OKP","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo","d":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}`,
+		"invalid encoding": `{"kty":"OKP","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo","d":"!"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := ParseJWKPrivateKey([]byte(jwk)); err == nil {
+				t.Error("parsed an invalid JWK")
+			}
+		})
+	}
+
+	if _, _, err := ParsePEMPrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})); err == nil {
+		t.Error("parsed a public key as a private key")
+	}
+}
+
+func TestLoadPrivateKey(t *testing.T) {
+	privateKey := ed25519.NewKeyFromSeed(testVectors[0].SK)
+	dir := t.TempDir()
+
+	for name, marshal := range map[string]func(ed25519.PrivateKey, Suite) ([]byte, error){
+		"key.pem":  MarshalPEMPrivateKey,
+		"key.json": MarshalJWKPrivateKey,
+	} {
+		t.Run(name, func(t *testing.T) {
+			b, err := marshal(privateKey, TAI)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, b, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, suite, err := LoadPrivateKey(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(privateKey) || suite != TAI {
+				t.Error("loaded a different key")
+			}
+
+			if runtime.GOOS == "windows" {
+				return
+			}
+
+			// Keys which other users can read are rejected.
+			if err := os.Chmod(path, 0640); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := LoadPrivateKey(path); err == nil || !strings.Contains(err.Error(), "permissions") {
+				t.Errorf("LoadPrivateKey() = %v, want a permissions error", err)
+			}
+		})
+	}
+
+	if _, _, err := LoadPrivateKey(dir); err == nil {
+		t.Error("loaded a directory")
+	}
+}
+
+// marshalPKCS8 encodes a private key as PKCS #8, as other tools do, ignoring its suite.
+func marshalPKCS8(privateKey ed25519.PrivateKey, _ Suite) ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(privateKey)
+}
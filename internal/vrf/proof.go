@@ -0,0 +1,87 @@
+package vrf
+
+import (
+	"encoding"
+	"errors"
+	"slices"
+
+	"filippo.io/edwards25519"
+)
+
+// ProofSize is the size of an encoded proof, in bytes.
+const ProofSize = 80
+
+// Proof is a proof created by a ProvingKey.
+type Proof struct {
+	gamma *edwards25519.Point
+	c, s  *edwards25519.Scalar
+}
+
+// ParseProof decodes the given proof. Returns ErrInvalidProof if the proof is not exactly ProofSize bytes long, if
+// Gamma is not the canonical encoding of a point, or if s is not a canonical scalar.
+func ParseProof(proof []byte) (*Proof, error) {
+	if len(proof) != ProofSize {
+		return nil, ErrInvalidProof
+	}
+
+	gamma, ok := decodePoint(proof[:32])
+	if !ok {
+		return nil, ErrInvalidProof
+	}
+
+	// c is 16 bytes long, so it is always a canonical scalar.
+	var buf [32]byte
+	copy(buf[:], proof[32:48])
+	c, err := new(edwards25519.Scalar).SetCanonicalBytes(buf[:])
+	if err != nil {
+		return nil, ErrInvalidProof
+	}
+
+	s, err := new(edwards25519.Scalar).SetCanonicalBytes(proof[48:])
+	if err != nil {
+		return nil, ErrInvalidProof
+	}
+
+	return &Proof{gamma: gamma, c: c, s: s}, nil
+}
+
+// ProofToHash returns the hash of the given proof for the given suite, without verifying the proof. The hash must not
+// be trusted unless the proof has been verified.
+func ProofToHash(suite Suite, proof *Proof) []byte {
+	return suite.hashProof(new(edwards25519.Point).MultByCofactor(proof.gamma).Bytes())
+}
+
+func (p *Proof) MarshalBinary() (data []byte, err error) {
+	if p.gamma == nil {
+		return nil, errors.New("vrf: uninitialized proof")
+	}
+
+	b := make([]byte, 0, ProofSize)
+	b = append(b, p.gamma.Bytes()...)
+	b = append(b, p.c.Bytes()[:16]...)
+	return append(b, p.s.Bytes()...), nil
+}
+
+func (p *Proof) UnmarshalBinary(data []byte) error {
+	x, err := ParseProof(data)
+	if err != nil {
+		return err
+	}
+
+	*p = *x
+	return nil
+}
+
+var (
+	_ encoding.BinaryMarshaler   = &Proof{}
+	_ encoding.BinaryUnmarshaler = &Proof{}
+)
+
+// decodePoint decodes the given point, rejecting non-canonical encodings as in RFC 8032.
+func decodePoint(b []byte) (*edwards25519.Point, bool) {
+	p, err := new(edwards25519.Point).SetBytes(b)
+	if err != nil || !slices.Equal(p.Bytes(), b) {
+		return nil, false
+	}
+	return p, true
+}
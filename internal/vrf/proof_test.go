@@ -0,0 +1,123 @@
+package vrf
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func TestProof(t *testing.T) {
+	for _, tv := range testVectors {
+		t.Run(tv.Name, func(t *testing.T) {
+			p, err := ParseProof(tv.Pi)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := ProofToHash(tv.Suite, p), tv.Beta; !bytes.Equal(got, want) {
+				t.Errorf("ProofToHash() = %x, want %x", got, want)
+			}
+
+			b, err := p.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, tv.Pi) {
+				t.Errorf("MarshalBinary() = %x, want %x", b, tv.Pi)
+			}
+
+			var p2 Proof
+			if err := p2.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := ProofToHash(tv.Suite, &p2), tv.Beta; !bytes.Equal(got, want) {
+				t.Errorf("ProofToHash() = %x, want %x", got, want)
+			}
+		})
+	}
+
+	// The identity point, encoded with y = p + 1.
+	nonCanonicalPoint := append([]byte{0xee}, bytes.Repeat([]byte{0xff}, 30)...)
+	nonCanonicalPoint = append(nonCanonicalPoint, 0x7f)
+
+	// The group order, which is the smallest non-canonical scalar.
+	nonCanonicalScalar := mustHexDecodeString("edd3f55c1a631258d69cf7a2def9de1400000000000000000000000000000010")
+
+	pi := testVectors[0].Pi
+	for name, proof := range map[string][]byte{
+		"empty":               nil,
+		"short":               pi[:ProofSize-1],
+		"long":                append(bytes.Clone(pi), 0),
+		"invalid gamma":       append(bytes.Repeat([]byte{0xff}, 32), pi[32:]...),
+		"non-canonical gamma": append(nonCanonicalPoint, pi[32:]...),
+		"non-canonical s":     append(bytes.Clone(pi[:48]), nonCanonicalScalar...),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseProof(proof); !errors.Is(err, ErrInvalidProof) {
+				t.Errorf("ParseProof() = %v, want ErrInvalidProof", err)
+			}
+
+			vk, err := NewVerifyingKey(testVectors[0].PK, WithSuite(testVectors[0].Suite))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := vk.Verify(testVectors[0].Alpha, proof); !errors.Is(err, ErrInvalidProof) {
+				t.Errorf("Verify() = %v, want ErrInvalidProof", err)
+			}
+		})
+	}
+
+	if _, err := new(Proof).MarshalBinary(); err == nil {
+		t.Error("marshaled an uninitialized proof")
+	}
+}
+
+func FuzzParseProof(f *testing.F) {
+	for _, tv := range testVectors {
+		f.Add(tv.Pi)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := ParseProof(data)
+		if err != nil {
+			return
+		}
+
+		// Valid proofs have a single encoding.
+		b, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Errorf("MarshalBinary() = %x, want %x", b, data)
+		}
+	})
+}
+
+func FuzzVerify(f *testing.F) {
+	for _, tv := range testVectors {
+		f.Add(byte(tv.Suite), []byte(tv.PK), tv.Alpha, tv.Pi)
+	}
+
+	f.Fuzz(func(t *testing.T, suite byte, publicKey, alpha, proof []byte) {
+		vk, err := NewVerifyingKey(ed25519.PublicKey(publicKey), WithSuite(Suite(suite)))
+		if err != nil {
+			return
+		}
+
+		hash, err := vk.Verify(alpha, proof)
+		if err != nil {
+			return
+		}
+
+		// A valid proof's hash can be computed without verifying it.
+		p, err := ParseProof(proof)
+		if err != nil {
+			t.Fatalf("verified a proof which could not be parsed: %v", err)
+		}
+		if got := ProofToHash(vk.Suite(), p); !bytes.Equal(got, hash) {
+			t.Errorf("ProofToHash() = %x, want %x", got, hash)
+		}
+	})
+}
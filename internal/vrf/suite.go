@@ -0,0 +1,159 @@
+package vrf
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"slices"
+
+	"filippo.io/edwards25519"
+	h2c "github.com/bytemare/hash2curve/edwards25519"
+)
+
+// Suite is an RFC 9381 ECVRF cipher suite, identified by its suite string.
+type Suite byte
+
+const (
+	// TAI is ECVRF-EDWARDS25519-SHA512-TAI, which encodes inputs to the curve by try-and-increment. The time it takes
+	// to encode an input depends on the input, so it must not be used with secret inputs.
+	TAI Suite = 0x03
+
+	// ELL2 is ECVRF-EDWARDS25519-SHA512-ELL2, which encodes inputs to the curve with the Elligator 2 map of RFC 9380.
+	ELL2 Suite = 0x04
+)
+
+func (s Suite) String() string {
+	switch s {
+	case TAI:
+		return "ECVRF-EDWARDS25519-SHA512-TAI"
+	case ELL2:
+		return "ECVRF-EDWARDS25519-SHA512-ELL2"
+	default:
+		return fmt.Sprintf("Suite(%#02x)", byte(s))
+	}
+}
+
+// ParseSuite returns the suite with the given name, as returned by Suite.String.
+func ParseSuite(name string) (Suite, error) {
+	for _, s := range []Suite{TAI, ELL2} {
+		if name == s.String() {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("vrf: unknown suite %q", name)
+}
+
+// Option configures a ProvingKey or VerifyingKey.
+type Option func(*options)
+
+type options struct {
+	suite      Suite
+	strict     bool
+	precompute bool
+}
+
+// WithSuite selects the cipher suite of a key's proofs. By default, ELL2 is used.
+func WithSuite(suite Suite) Option {
+	return func(o *options) {
+		o.suite = suite
+	}
+}
+
+// WithStrictKey makes NewVerifyingKey validate the public key as RFC 9381's ECVRF_validate_key does, rejecting points of
+// small order. A prover with a small-order key can create valid proofs of different hashes for the same input, so keys
+// which aren't trusted must be validated if the hashes must be unique. It has no effect on a ProvingKey.
+func WithStrictKey() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// WithPrecomputedTable makes NewVerifyingKey precompute a table of multiples of the public key, which makes each
+// verification faster at the cost of about 40 KiB of memory and the time of a few verifications to build the table. It
+// is worthwhile for long-lived keys which verify many proofs. It has no effect on a ProvingKey.
+func WithPrecomputedTable() Option {
+	return func(o *options) {
+		o.precompute = true
+	}
+}
+
+func newOptions(opts []Option) (*options, error) {
+	o := &options{suite: ELL2}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.suite != TAI && o.suite != ELL2 {
+		return nil, fmt.Errorf("vrf: unknown suite %v", o.suite)
+	}
+
+	return o, nil
+}
+
+// encodeToCurve encodes the given input to a point, using the given public key as a salt.
+func (s Suite) encodeToCurve(salt, alpha []byte) *edwards25519.Point {
+	if s == TAI {
+		return encodeToCurveTAI(salt, alpha)
+	}
+	return h2c.EncodeToCurve(slices.Concat(salt, alpha), []byte("ECVRF_edwards25519_XMD:SHA-512_ELL2_NU_\x04"))
+}
+
+// encodeToCurveTAI implements RFC 9381's ECVRF_encode_to_curve_try_and_increment.
+func encodeToCurveTAI(salt, alpha []byte) *edwards25519.Point {
+	for ctr := range 256 {
+		h := sha512.New()
+		h.Write([]byte{byte(TAI), encodeDomainSeparatorFront})
+		h.Write(salt)
+		h.Write(alpha)
+		h.Write([]byte{byte(ctr), encodeDomainSeparatorBack})
+
+		p, ok := decodePoint(h.Sum(nil)[:32])
+		if !ok {
+			continue
+		}
+
+		p.MultByCofactor(p)
+		if p.Equal(edwards25519.NewIdentityPoint()) == 0 {
+			return p
+		}
+	}
+
+	// Each attempt fails with a probability of about one half.
+	panic("vrf: internal error: try-and-increment failed")
+}
+
+// hashProof returns the proof hash for the given encoding of Gamma multiplied by the cofactor.
+func (s Suite) hashProof(cofactorGamma []byte) []byte {
+	h := sha512.New()
+	h.Write([]byte{byte(s), proofDomainSeparatorFront})
+	h.Write(cofactorGamma)
+	h.Write([]byte{proofDomainSeparatorBack})
+	return h.Sum(nil)
+}
+
+// generateChallenge returns the challenge for the given point encodings.
+func (s Suite) generateChallenge(p1, p2, p3, p4, p5 []byte) *edwards25519.Scalar {
+	h := sha512.New()
+	h.Write([]byte{byte(s), challengeDomainSeparatorFront})
+	h.Write(p1)
+	h.Write(p2)
+	h.Write(p3)
+	h.Write(p4)
+	h.Write(p5)
+	h.Write([]byte{challengeDomainSeparatorBack})
+
+	cStr := append(h.Sum(nil)[:16], make([]byte, 16)...)
+	c, err := new(edwards25519.Scalar).SetCanonicalBytes(cStr)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+const (
+	encodeDomainSeparatorFront    = 0x01
+	encodeDomainSeparatorBack     = 0x00
+	challengeDomainSeparatorFront = 0x02
+	challengeDomainSeparatorBack  = 0x00
+	proofDomainSeparatorFront     = 0x03
+	proofDomainSeparatorBack      = 0x00
+)
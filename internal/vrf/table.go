@@ -0,0 +1,65 @@
+package vrf
+
+import (
+	"filippo.io/edwards25519"
+)
+
+// challengeDigits is the number of signed radix-16 digits of a challenge. Challenges are 128 bits long, and the carry
+// from recentering the top digit requires one more.
+const challengeDigits = 33
+
+// pointTable is a fixed-window table of multiples of a point P, with which c*P can be computed for any challenge c with
+// one point addition per digit of c and no doublings. Entry [i][j] is (j+1) * 16^i * P.
+type pointTable [challengeDigits][8]edwards25519.Point
+
+// newPointTable returns a table of multiples of the given point.
+func newPointTable(p *edwards25519.Point) *pointTable {
+	t := new(pointTable)
+	base := new(edwards25519.Point).Set(p)
+	for i := range t {
+		t[i][0].Set(base)
+		for j := 1; j < len(t[i]); j++ {
+			t[i][j].Add(&t[i][j-1], base)
+		}
+
+		// 16^(i+1) * P = 2 * 8 * 16^i * P.
+		base.Add(&t[i][7], &t[i][7])
+	}
+	return t
+}
+
+// varTimeMultChallenge sets v to c*P, where c is a challenge, in variable time.
+func (t *pointTable) varTimeMultChallenge(v *edwards25519.Point, c *edwards25519.Scalar) *edwards25519.Point {
+	digits := challengeToRadix16(c)
+	v.Set(edwards25519.NewIdentityPoint())
+	for i, d := range digits {
+		switch {
+		case d > 0:
+			v.Add(v, &t[i][d-1])
+		case d < 0:
+			v.Subtract(v, &t[i][-d-1])
+		}
+	}
+	return v
+}
+
+// challengeToRadix16 returns the signed radix-16 digits of the given challenge, in [-8, 8).
+func challengeToRadix16(c *edwards25519.Scalar) [challengeDigits]int8 {
+	b := c.Bytes()
+
+	var digits [challengeDigits]int8
+	for i := range 16 {
+		digits[2*i] = int8(b[i] & 15)
+		digits[2*i+1] = int8(b[i] >> 4)
+	}
+
+	// Recenter the digits from [0, 16) to [-8, 8), carrying into the next digit.
+	for i := range challengeDigits - 1 {
+		if digits[i] >= 8 {
+			digits[i] -= 16
+			digits[i+1]++
+		}
+	}
+
+	return digits
+}
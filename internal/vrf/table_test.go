@@ -0,0 +1,83 @@
+package vrf
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"filippo.io/edwards25519"
+)
+
+func TestPointTable(t *testing.T) {
+	y, err := new(edwards25519.Point).SetBytes(testVectors[0].PK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := newPointTable(y)
+
+	for _, b := range [][]byte{
+		bytes.Repeat([]byte{0x00}, 16),
+		bytes.Repeat([]byte{0x88}, 16),
+		bytes.Repeat([]byte{0xff}, 16),
+		testVectors[0].Pi[32:48],
+		testVectors[1].Pi[32:48],
+	} {
+		c, err := new(edwards25519.Scalar).SetCanonicalBytes(append(bytes.Clone(b), make([]byte, 16)...))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := new(edwards25519.Point).ScalarMult(c, y)
+		if got := table.varTimeMultChallenge(new(edwards25519.Point), c); got.Equal(want) != 1 {
+			t.Errorf("varTimeMultChallenge(%x) = %x, want %x", b, got.Bytes(), want.Bytes())
+		}
+	}
+}
+
+func TestPrecomputedTable(t *testing.T) {
+	for _, tv := range testVectors {
+		t.Run(tv.Name, func(t *testing.T) {
+			vk, err := NewVerifyingKey(tv.PK, WithSuite(tv.Suite), WithPrecomputedTable())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			beta, err := vk.Verify(tv.Alpha, tv.Pi)
+			if err != nil || !bytes.Equal(beta, tv.Beta) {
+				t.Errorf("Verify(%x, %x) = %x, %v, want = %x", tv.Alpha, tv.Pi, beta, err, tv.Beta)
+			}
+
+			if _, err := vk.Verify([]byte("something else"), tv.Pi); !errors.Is(err, ErrInvalidProof) {
+				t.Errorf("Verify() = %v, want ErrInvalidProof", err)
+			}
+		})
+	}
+
+	// Unmarshaling a key keeps its table.
+	sk := NewProvingKey(ed25519.NewKeyFromSeed(testVectors[0].SK))
+	alphas, proofs, want := newTestBatch(20, sk.Prove)
+	vk := &VerifyingKey{table: new(pointTable)}
+	if err := vk.UnmarshalBinary(sk.VerifyingKey.encoded); err != nil {
+		t.Fatal(err)
+	}
+	if vk.table == nil {
+		t.Fatal("table was not precomputed")
+	}
+	if vk.Precompute() != vk {
+		t.Error("Precompute() rebuilt an existing table")
+	}
+	if sk.VerifyingKey.Precompute().table == nil || sk.VerifyingKey.table != nil {
+		t.Error("Precompute() did not copy the key with a table")
+	}
+
+	for i := range proofs {
+		hash, err := vk.Verify(alphas[i], proofs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(hash, want[i]) {
+			t.Errorf("hashes[%d] = %x, want %x", i, hash, want[i])
+		}
+	}
+}
@@ -0,0 +1,531 @@
+package vrf
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"slices"
+
+	"filippo.io/edwards25519"
+)
+
+// Threshold proving splits a proving key's secret scalar among n participants with Shamir's secret sharing, so that
+// any threshold of them can jointly create a standard proof, but fewer cannot. Proofs are created in two rounds, which
+// adapt FROST (RFC 9591) to the two bases of an ECVRF proof:
+//
+//  1. Each participant calls KeyShare.Commit and sends the resulting Commitment to the others and to the combiner. The
+//     commitment contains the participant's partial evaluation of the input, with a DLEQ proof of its correctness, and
+//     commitments to two single-use nonces.
+//  2. Each participant calls KeyShare.Sign with the commitments of the participating set and sends the resulting
+//     SignatureShare to the combiner, which calls ThresholdKey.Combine to check each share and create the proof.
+//
+// The nonces returned by Commit must only be used once.
+
+// MaxParticipants is the largest number of participants in a threshold key.
+const MaxParticipants = 255
+
+// ErrInvalidShare is returned when a participant's commitment, signature share, or key generation share is invalid.
+var ErrInvalidShare = errors.New("vrf: invalid threshold share")
+
+// ThresholdKey is the public part of a threshold key: the verifying key of its proofs, and the verification share of
+// each participant.
+type ThresholdKey struct {
+	vk        *VerifyingKey
+	threshold int
+	shares    []*edwards25519.Point
+}
+
+// VerifyingKey returns the key which verifies proofs created with the threshold key.
+func (tk *ThresholdKey) VerifyingKey() *VerifyingKey {
+	return tk.vk
+}
+
+// Threshold returns the number of participants required to create a proof.
+func (tk *ThresholdKey) Threshold() int {
+	return tk.threshold
+}
+
+// Participants returns the number of participants which hold shares of the key.
+func (tk *ThresholdKey) Participants() int {
+	return len(tk.shares)
+}
+
+func (tk *ThresholdKey) MarshalBinary() (data []byte, err error) {
+	if tk.vk == nil {
+		return nil, errors.New("vrf: uninitialized threshold key")
+	}
+
+	b := make([]byte, 0, 3+32*(1+len(tk.shares)))
+	b = append(b, byte(tk.vk.suite), byte(tk.threshold), byte(len(tk.shares)))
+	b = append(b, tk.vk.encoded...)
+	for _, p := range tk.shares {
+		b = append(b, p.Bytes()...)
+	}
+	return b, nil
+}
+
+func (tk *ThresholdKey) UnmarshalBinary(data []byte) error {
+	x, err := parseThresholdKey(data)
+	if err != nil {
+		return err
+	}
+
+	*tk = *x
+	return nil
+}
+
+func parseThresholdKey(data []byte) (*ThresholdKey, error) {
+	if len(data) < 35 || len(data) != 35+32*int(data[2]) {
+		return nil, errors.New("vrf: invalid threshold key length")
+	}
+	if err := checkThreshold(int(data[1]), int(data[2])); err != nil {
+		return nil, err
+	}
+
+	vk, err := NewVerifyingKey(data[3:35], WithSuite(Suite(data[0])))
+	if err != nil {
+		return nil, err
+	}
+
+	tk := &ThresholdKey{vk: vk, threshold: int(data[1]), shares: make([]*edwards25519.Point, data[2])}
+	for i := range tk.shares {
+		var ok bool
+		if tk.shares[i], ok = decodePoint(data[35+32*i : 67+32*i]); !ok {
+			return nil, errors.New("vrf: invalid verification share")
+		}
+	}
+	return tk, nil
+}
+
+// KeyShare is a participant's share of a threshold key. It must be kept secret.
+type KeyShare struct {
+	id int
+	x  *edwards25519.Scalar
+	tk *ThresholdKey
+}
+
+// Deal splits the given proving key into n shares, any threshold of which can create its proofs. The proofs are
+// verified by the proving key's VerifyingKey and have the same hashes as the proving key's proofs, so an existing
+// key can be split without changing its hashes. The dealer must securely erase the private key from which the proving
+// key was derived afterwards.
+func Deal(pk *ProvingKey, threshold, n int) ([]*KeyShare, error) {
+	if err := checkThreshold(threshold, n); err != nil {
+		return nil, err
+	}
+
+	// Share the secret scalar as the constant term of a random polynomial of degree threshold-1.
+	coeffs := make([]*edwards25519.Scalar, threshold)
+	coeffs[0] = pk.x
+	for i := 1; i < threshold; i++ {
+		coeffs[i] = randomScalar()
+	}
+
+	vk := pk.VerifyingKey
+	tk := &ThresholdKey{vk: &vk, threshold: threshold, shares: make([]*edwards25519.Point, n)}
+	keyShares := make([]*KeyShare, n)
+	for i := range keyShares {
+		x := evalPolynomial(coeffs, i+1)
+		tk.shares[i] = new(edwards25519.Point).ScalarBaseMult(x)
+		keyShares[i] = &KeyShare{id: i + 1, x: x, tk: tk}
+	}
+	return keyShares, nil
+}
+
+// ID returns the participant's identifier, from 1 to the number of participants.
+func (ks *KeyShare) ID() int {
+	return ks.id
+}
+
+// ThresholdKey returns the public part of the threshold key.
+func (ks *KeyShare) ThresholdKey() *ThresholdKey {
+	return ks.tk
+}
+
+// Commit begins the creation of a proof of the given input, returning the participant's secret nonces and its public
+// commitment. The nonces must be passed to Sign, and must not be reused.
+func (ks *KeyShare) Commit(alpha []byte) (*Nonces, *Commitment) {
+	suite := ks.tk.vk.suite
+	h := suite.encodeToCurve(ks.tk.vk.encoded, alpha)
+
+	// Evaluate the input with the participant's share, proving that the same share was used as for its verification
+	// share.
+	gamma := new(edwards25519.Point).ScalarMult(ks.x, h)
+	proof := proveDLEQ(suite, ks.x, ks.tk.shares[ks.id-1], h, gamma)
+
+	// Commit to a hiding nonce and a binding nonce on both bases.
+	d, e := hedgedNonce(ks.x, h), hedgedNonce(ks.x, h)
+	c := &Commitment{
+		id:    ks.id,
+		proof: proof,
+		db:    new(edwards25519.Point).ScalarBaseMult(d),
+		eb:    new(edwards25519.Point).ScalarBaseMult(e),
+		dh:    new(edwards25519.Point).ScalarMult(d, h),
+		eh:    new(edwards25519.Point).ScalarMult(e, h),
+	}
+	return &Nonces{h: h, d: d, e: e, commitment: c}, c
+}
+
+// Sign returns the participant's signature share for the input of the given nonces, given the commitments of each
+// participant in the signing set, in ascending order of ID. The nonces are erased.
+func (ks *KeyShare) Sign(nonces *Nonces, commitments []*Commitment) (*SignatureShare, error) {
+	if nonces.d == nil {
+		return nil, errors.New("vrf: nonces already used")
+	}
+
+	i := slices.IndexFunc(commitments, func(c *Commitment) bool { return c.id == ks.id })
+	if i < 0 || !commitments[i].equal(nonces.commitment) {
+		return nil, errors.New("vrf: participant's commitment is missing")
+	}
+
+	tc, err := ks.tk.newThresholdContext(nonces.h, commitments)
+	if err != nil {
+		return nil, err
+	}
+
+	// z = d + e*rho + c*lambda*x
+	z := new(edwards25519.Scalar).Multiply(tc.lambdas[i], ks.x)
+	z.Multiply(z, tc.c)
+	z.Add(z, nonces.d)
+	z.MultiplyAdd(nonces.e, tc.rhos[i], z)
+
+	nonces.d, nonces.e = nil, nil
+	return &SignatureShare{id: ks.id, z: z}, nil
+}
+
+func (ks *KeyShare) MarshalBinary() (data []byte, err error) {
+	if ks.tk == nil {
+		return nil, errors.New("vrf: uninitialized key share")
+	}
+
+	tk, err := ks.tk.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return slices.Concat([]byte{byte(ks.id)}, ks.x.Bytes(), tk), nil
+}
+
+func (ks *KeyShare) UnmarshalBinary(data []byte) error {
+	if len(data) < 33 {
+		return errors.New("vrf: invalid key share length")
+	}
+
+	tk, err := parseThresholdKey(data[33:])
+	if err != nil {
+		return err
+	}
+
+	id := int(data[0])
+	if id < 1 || id > len(tk.shares) {
+		return errors.New("vrf: invalid key share ID")
+	}
+
+	x, err := new(edwards25519.Scalar).SetCanonicalBytes(data[1:33])
+	if err != nil {
+		return err
+	}
+	if new(edwards25519.Point).ScalarBaseMult(x).Equal(tk.shares[id-1]) != 1 {
+		return errors.New("vrf: key share does not match its verification share")
+	}
+
+	*ks = KeyShare{id: id, x: x, tk: tk}
+	return nil
+}
+
+// Combine checks the given signature shares of the given input, created with the given commitments, and combines them
+// into a proof which is verified by the threshold key's VerifyingKey. Returns the proof and its hash, or an error
+// wrapping ErrInvalidShare which identifies the first invalid commitment or signature share.
+func (tk *ThresholdKey) Combine(alpha []byte, commitments []*Commitment, shares []*SignatureShare) (proof, hash []byte, err error) {
+	h := tk.vk.suite.encodeToCurve(tk.vk.encoded, alpha)
+	tc, err := tk.newThresholdContext(h, commitments)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(shares) != len(commitments) {
+		return nil, nil, errors.New("vrf: mismatched number of commitments and signature shares")
+	}
+
+	s := edwards25519.NewScalar()
+	for i, c := range commitments {
+		j := slices.IndexFunc(shares, func(share *SignatureShare) bool { return share.id == c.id })
+		if j < 0 {
+			return nil, nil, fmt.Errorf("vrf: missing signature share from participant %d", c.id)
+		}
+		z := shares[j].z
+
+		// z*B = D + rho*E + c*lambda*Y_i and z*H = D' + rho*E' + c*lambda*Gamma_i, if the share is valid.
+		negCL := new(edwards25519.Scalar).Multiply(tc.c, tc.lambdas[i])
+		negCL.Negate(negCL)
+		zb := new(edwards25519.Point).VarTimeMultiScalarMult(
+			[]*edwards25519.Scalar{z, negCL}, []*edwards25519.Point{edwards25519.NewGeneratorPoint(), tk.shares[c.id-1]})
+		zh := new(edwards25519.Point).VarTimeMultiScalarMult(
+			[]*edwards25519.Scalar{z, negCL}, []*edwards25519.Point{h, c.proof.gamma})
+		if zb.Equal(tc.rs[i][0]) != 1 || zh.Equal(tc.rs[i][1]) != 1 {
+			return nil, nil, fmt.Errorf("%w: signature share from participant %d", ErrInvalidShare, c.id)
+		}
+
+		s.Add(s, z)
+	}
+
+	proof, err = (&Proof{gamma: tc.gamma, c: tc.c, s: s}).MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hash, err = tk.vk.Verify(alpha, proof)
+	if err != nil {
+		return nil, nil, err
+	}
+	return proof, hash, nil
+}
+
+// thresholdContext contains the values which both the participants and the combiner derive from the commitments of
+// the signing set.
+type thresholdContext struct {
+	gamma   *edwards25519.Point
+	c       *edwards25519.Scalar
+	lambdas []*edwards25519.Scalar
+	rhos    []*edwards25519.Scalar
+
+	// rs contains each participant's combined nonce commitments on the base point and on H.
+	rs [][2]*edwards25519.Point
+}
+
+func (tk *ThresholdKey) newThresholdContext(h *edwards25519.Point, commitments []*Commitment) (*thresholdContext, error) {
+	if len(commitments) < tk.threshold {
+		return nil, fmt.Errorf("vrf: %d commitments, want at least %d", len(commitments), tk.threshold)
+	}
+
+	ids := make([]int, len(commitments))
+	for i, c := range commitments {
+		if c.id < 1 || c.id > len(tk.shares) || (i > 0 && c.id <= ids[i-1]) {
+			return nil, errors.New("vrf: commitments must have distinct, ascending participant IDs")
+		}
+		ids[i] = c.id
+
+		// Check each participant's partial evaluation against its verification share.
+		if !verifyDLEQ(tk.vk.suite, tk.shares[c.id-1], h, c.proof) {
+			return nil, fmt.Errorf("%w: commitment from participant %d", ErrInvalidShare, c.id)
+		}
+	}
+
+	tc := &thresholdContext{
+		lambdas: make([]*edwards25519.Scalar, len(commitments)),
+		rhos:    make([]*edwards25519.Scalar, len(commitments)),
+		rs:      make([][2]*edwards25519.Point, len(commitments)),
+	}
+
+	// Bind each participant's nonces to the key, the input, and the commitments of the whole signing set.
+	t := sha512.New()
+	t.Write([]byte("keydonkey threshold ECVRF binding"))
+	t.Write([]byte{byte(tk.vk.suite)})
+	t.Write(tk.vk.encoded)
+	t.Write(h.Bytes())
+	for _, c := range commitments {
+		t.Write(c.marshal())
+	}
+	transcript := t.Sum(nil)
+
+	gammas := make([]*edwards25519.Point, len(commitments))
+	u, v := edwards25519.NewIdentityPoint(), edwards25519.NewIdentityPoint()
+	one := scalarFromInt(1)
+	for i, c := range commitments {
+		tc.lambdas[i] = lagrange(c.id, ids)
+		tc.rhos[i] = hashToScalar(transcript, []byte{byte(c.id)})
+		gammas[i] = c.proof.gamma
+
+		tc.rs[i][0] = new(edwards25519.Point).VarTimeMultiScalarMult(
+			[]*edwards25519.Scalar{one, tc.rhos[i]}, []*edwards25519.Point{c.db, c.eb})
+		tc.rs[i][1] = new(edwards25519.Point).VarTimeMultiScalarMult(
+			[]*edwards25519.Scalar{one, tc.rhos[i]}, []*edwards25519.Point{c.dh, c.eh})
+		u.Add(u, tc.rs[i][0])
+		v.Add(v, tc.rs[i][1])
+	}
+
+	// Interpolate the partial evaluations to evaluate the input with the secret scalar.
+	tc.gamma = new(edwards25519.Point).VarTimeMultiScalarMult(tc.lambdas, gammas)
+	tc.c = tk.vk.suite.generateChallenge(tk.vk.encoded, h.Bytes(), tc.gamma.Bytes(), u.Bytes(), v.Bytes())
+	return tc, nil
+}
+
+// Nonces are a participant's secret nonces for a single proof.
+type Nonces struct {
+	h          *edwards25519.Point
+	d, e       *edwards25519.Scalar
+	commitment *Commitment
+}
+
+// Commitment is a participant's public commitment for a single proof.
+type Commitment struct {
+	id             int
+	proof          *Proof
+	db, eb, dh, eh *edwards25519.Point
+}
+
+// commitmentSize is the size of an encoded commitment, in bytes.
+const commitmentSize = 1 + ProofSize + 4*32
+
+// ID returns the participant's identifier.
+func (c *Commitment) ID() int {
+	return c.id
+}
+
+func (c *Commitment) MarshalBinary() (data []byte, err error) {
+	if c.proof == nil {
+		return nil, errors.New("vrf: uninitialized commitment")
+	}
+	return c.marshal(), nil
+}
+
+func (c *Commitment) marshal() []byte {
+	proof, _ := c.proof.MarshalBinary()
+	return slices.Concat([]byte{byte(c.id)}, proof, c.db.Bytes(), c.eb.Bytes(), c.dh.Bytes(), c.eh.Bytes())
+}
+
+func (c *Commitment) UnmarshalBinary(data []byte) error {
+	if len(data) != commitmentSize || data[0] == 0 {
+		return errors.New("vrf: invalid commitment")
+	}
+
+	proof, err := ParseProof(data[1 : 1+ProofSize])
+	if err != nil {
+		return err
+	}
+
+	points := make([]*edwards25519.Point, 4)
+	for i := range points {
+		var ok bool
+		if points[i], ok = decodePoint(data[1+ProofSize+32*i : 1+ProofSize+32*(i+1)]); !ok {
+			return errors.New("vrf: invalid commitment")
+		}
+	}
+
+	*c = Commitment{id: int(data[0]), proof: proof, db: points[0], eb: points[1], dh: points[2], eh: points[3]}
+	return nil
+}
+
+func (c *Commitment) equal(other *Commitment) bool {
+	return bytes.Equal(c.marshal(), other.marshal())
+}
+
+// SignatureShare is a participant's share of a proof.
+type SignatureShare struct {
+	id int
+	z  *edwards25519.Scalar
+}
+
+// ID returns the participant's identifier.
+func (s *SignatureShare) ID() int {
+	return s.id
+}
+
+func (s *SignatureShare) MarshalBinary() (data []byte, err error) {
+	if s.z == nil {
+		return nil, errors.New("vrf: uninitialized signature share")
+	}
+	return append([]byte{byte(s.id)}, s.z.Bytes()...), nil
+}
+
+func (s *SignatureShare) UnmarshalBinary(data []byte) error {
+	if len(data) != 33 || data[0] == 0 {
+		return errors.New("vrf: invalid signature share")
+	}
+
+	z, err := new(edwards25519.Scalar).SetCanonicalBytes(data[1:])
+	if err != nil {
+		return err
+	}
+
+	*s = SignatureShare{id: int(data[0]), z: z}
+	return nil
+}
+
+// proveDLEQ returns a proof that gamma = x*h for the x such that y = x*B. The proof is an ECVRF proof of the input
+// encoded to h with the key y.
+func proveDLEQ(suite Suite, x *edwards25519.Scalar, y, h, gamma *edwards25519.Point) *Proof {
+	k := hedgedNonce(x, h)
+	c := suite.generateChallenge(y.Bytes(), h.Bytes(), gamma.Bytes(),
+		new(edwards25519.Point).ScalarBaseMult(k).Bytes(), new(edwards25519.Point).ScalarMult(k, h).Bytes())
+	return &Proof{gamma: gamma, c: c, s: new(edwards25519.Scalar).MultiplyAdd(c, x, k)}
+}
+
+// verifyDLEQ returns true if the given proof is a valid proof that its gamma = x*h for the x such that y = x*B.
+func verifyDLEQ(suite Suite, y, h *edwards25519.Point, proof *Proof) bool {
+	negC := new(edwards25519.Scalar).Negate(proof.c)
+	u := new(edwards25519.Point).VarTimeDoubleScalarBaseMult(negC, y, proof.s)
+	v := new(edwards25519.Point).VarTimeMultiScalarMult([]*edwards25519.Scalar{proof.s, negC},
+		[]*edwards25519.Point{h, proof.gamma})
+	c := suite.generateChallenge(y.Bytes(), h.Bytes(), proof.gamma.Bytes(), u.Bytes(), v.Bytes())
+	return c.Equal(proof.c) == 1
+}
+
+func checkThreshold(threshold, n int) error {
+	if n > MaxParticipants || threshold < 2 || threshold > n {
+		return fmt.Errorf("vrf: invalid threshold %d of %d participants", threshold, n)
+	}
+	return nil
+}
+
+// lagrange returns the Lagrange coefficient of the given participant for interpolating at zero from the given
+// participants.
+func lagrange(id int, ids []int) *edwards25519.Scalar {
+	num, den := scalarFromInt(1), scalarFromInt(1)
+	x := scalarFromInt(id)
+	for _, j := range ids {
+		if j == id {
+			continue
+		}
+		xj := scalarFromInt(j)
+		num.Multiply(num, xj)
+		den.Multiply(den, new(edwards25519.Scalar).Subtract(xj, x))
+	}
+	return num.Multiply(num, den.Invert(den))
+}
+
+// evalPolynomial returns the value at x of the polynomial with the given coefficients, in ascending order of degree.
+func evalPolynomial(coeffs []*edwards25519.Scalar, x int) *edwards25519.Scalar {
+	xs := scalarFromInt(x)
+	v := edwards25519.NewScalar()
+	for _, c := range slices.Backward(coeffs) {
+		v.MultiplyAdd(v, xs, c)
+	}
+	return v
+}
+
+func scalarFromInt(i int) *edwards25519.Scalar {
+	var b [32]byte
+	b[0], b[1] = byte(i), byte(i>>8)
+	s, err := new(edwards25519.Scalar).SetCanonicalBytes(b[:])
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func randomScalar() *edwards25519.Scalar {
+	var b [64]byte
+	_, _ = rand.Read(b[:])
+	return hashToScalar(b[:])
+}
+
+// hedgedNonce returns a single-use nonce derived from random bytes, the given secret scalar, and the given point, so
+// that it remains unpredictable if the random number generator fails.
+func hedgedNonce(x *edwards25519.Scalar, p *edwards25519.Point) *edwards25519.Scalar {
+	var b [32]byte
+	_, _ = rand.Read(b[:])
+	return hashToScalar(b[:], x.Bytes(), p.Bytes())
+}
+
+func hashToScalar(data ...[]byte) *edwards25519.Scalar {
+	h := sha512.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	s, err := new(edwards25519.Scalar).SetUniformBytes(h.Sum(nil))
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
@@ -0,0 +1,268 @@
+package vrf
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestThresholdDeal(t *testing.T) {
+	for _, suite := range []Suite{TAI, ELL2} {
+		t.Run(suite.String(), func(t *testing.T) {
+			sk := NewProvingKey(ed25519.NewKeyFromSeed(testVectors[0].SK), WithSuite(suite))
+			keyShares, err := Deal(sk, 2, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Any two participants, or all three, can create a proof, which has the same hash as the proving key's.
+			for _, ids := range [][]int{{1, 2}, {1, 3}, {2, 3}, {1, 2, 3}} {
+				t.Run(fmt.Sprint(ids), func(t *testing.T) {
+					alpha := []byte("dingus")
+					proof, hash, err := proveThreshold(t, keyShares, ids, alpha)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					got, err := sk.VerifyingKey.Verify(alpha, proof)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if _, want := sk.Prove(alpha); !bytes.Equal(got, want) || !bytes.Equal(hash, want) {
+						t.Errorf("hash = %x, want %x", got, want)
+					}
+				})
+			}
+
+			// A single participant cannot.
+			if _, _, err := proveThreshold(t, keyShares, []int{2}, []byte("dingus")); err == nil {
+				t.Error("created a proof with one participant")
+			}
+		})
+	}
+
+	if _, err := Deal(NewProvingKey(ed25519.NewKeyFromSeed(testVectors[0].SK)), 1, 3); err == nil {
+		t.Error("dealt a key with a threshold of one")
+	}
+}
+
+func TestThresholdDKG(t *testing.T) {
+	const n = 3
+
+	// Each participant sends its commitment to every other participant.
+	session := []byte("session")
+	dkgs := make([]*DKG, n)
+	commitments := make([]*DKGCommitment, n)
+	for i := range n {
+		var err error
+		dkgs[i], commitments[i], err = NewDKG(session, i+1, 2, n, WithSuite(TAI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitments[i] = roundTrip(t, commitments[i], new(DKGCommitment))
+	}
+
+	// Each participant sends a share and a confirmation to each other participant.
+	received := make([][]*DKGShare, n)
+	confirmations := make([][][]byte, n)
+	for i := range n {
+		shares, err := dkgs[i].Shares(commitments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, share := range shares {
+			received[share.To()-1] = append(received[share.To()-1], roundTrip(t, share, new(DKGShare)))
+		}
+
+		confirmation, err := dkgs[i].Confirmation(commitments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := range n {
+			if j != i {
+				confirmations[j] = append(confirmations[j], confirmation)
+			}
+		}
+	}
+
+	// A share which doesn't match its sender's commitment is rejected.
+	tampered := slices.Clone(received[0])
+	tampered[0] = &DKGShare{from: tampered[0].from, to: tampered[0].to, value: scalarFromInt(1)}
+	if _, err := dkgs[0].Finish(commitments, tampered, confirmations[0]); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("Finish() = %v, want ErrInvalidShare", err)
+	}
+
+	// So is a confirmation from a participant which received a different commitment from another participant.
+	_, equivocated, err := NewDKG(session, 3, 2, n, WithSuite(TAI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherConfirmation, err := dkgs[1].Confirmation([]*DKGCommitment{commitments[0], commitments[1], equivocated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dkgs[0].Finish(commitments, received[0], [][]byte{otherConfirmation, confirmations[0][1]}); !errors.Is(err, ErrTranscriptMismatch) {
+		t.Errorf("Finish() = %v, want ErrTranscriptMismatch", err)
+	}
+
+	// Commitments are bound to their session.
+	_, replayed, err := NewDKG([]byte("other session"), 3, 2, n, WithSuite(TAI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dkgs[0].Shares([]*DKGCommitment{commitments[0], commitments[1], replayed}); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("Shares() = %v, want ErrInvalidShare", err)
+	}
+
+	keyShares := make([]*KeyShare, n)
+	for i := range n {
+		var err error
+		keyShares[i], err = dkgs[i].Finish(commitments, received[i], confirmations[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every participant agrees on the public part of the key.
+	want, err := keyShares[0].ThresholdKey().MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ks := range keyShares[1:] {
+		got, err := ks.ThresholdKey().MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("participant %d's threshold key = %x, want %x", ks.ID(), got, want)
+		}
+	}
+
+	vk := keyShares[0].ThresholdKey().VerifyingKey()
+	for _, ids := range [][]int{{1, 2}, {1, 3}, {2, 3}} {
+		alpha := []byte("dingus")
+		proof, hash, err := proveThreshold(t, keyShares, ids, alpha)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := vk.Verify(alpha, proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, hash) {
+			t.Errorf("hash = %x, want %x", got, hash)
+		}
+	}
+
+	if _, err := dkgs[0].Finish(commitments, received[0], confirmations[0]); err == nil {
+		t.Error("finished key generation twice")
+	}
+}
+
+func TestThresholdInvalidShares(t *testing.T) {
+	sk := NewProvingKey(ed25519.NewKeyFromSeed(testVectors[0].SK))
+	keyShares, err := Deal(sk, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := keyShares[0].ThresholdKey()
+	alpha := []byte("dingus")
+
+	n1, c1 := keyShares[0].Commit(alpha)
+	n2, c2 := keyShares[1].Commit(alpha)
+	commitments := []*Commitment{c1, c2}
+
+	s1, err := keyShares[0].Sign(n1, commitments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := keyShares[1].Sign(n2, commitments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := keyShares[0].Sign(n1, commitments); err == nil {
+		t.Error("signed with used nonces")
+	}
+
+	// A signature share which doesn't match its commitment identifies its participant.
+	bad := &SignatureShare{id: 2, z: scalarFromInt(1)}
+	if _, _, err := tk.Combine(alpha, commitments, []*SignatureShare{s1, bad}); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("Combine() = %v, want ErrInvalidShare", err)
+	}
+
+	// So does a partial evaluation which doesn't match its verification share.
+	_, c3 := keyShares[2].Commit([]byte("something else"))
+	c3.id = 2
+	if _, _, err := tk.Combine(alpha, []*Commitment{c1, c3}, []*SignatureShare{s1, s2}); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("Combine() = %v, want ErrInvalidShare", err)
+	}
+
+	// Signature shares are bound to the input.
+	if _, _, err := tk.Combine([]byte("something else"), commitments, []*SignatureShare{s1, s2}); err == nil {
+		t.Error("combined shares of another input")
+	}
+
+	if _, _, err := tk.Combine(alpha, []*Commitment{c2, c1}, []*SignatureShare{s2, s1}); err == nil {
+		t.Error("combined out-of-order commitments")
+	}
+
+	proof, _, err := tk.Combine(alpha, commitments, []*SignatureShare{s2, s1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sk.VerifyingKey.Verify(alpha, proof); err != nil {
+		t.Error(err)
+	}
+}
+
+// proveThreshold creates a proof of the given input with the key shares of the given participants, exchanging their
+// messages in their encoded forms.
+func proveThreshold(t *testing.T, keyShares []*KeyShare, ids []int, alpha []byte) (proof, hash []byte, err error) {
+	t.Helper()
+
+	// Each participant stores and reloads its key share.
+	participants := make([]*KeyShare, len(ids))
+	for i, id := range ids {
+		participants[i] = roundTrip(t, keyShares[id-1], new(KeyShare))
+	}
+
+	nonces := make([]*Nonces, len(ids))
+	commitments := make([]*Commitment, len(ids))
+	for i, ks := range participants {
+		var c *Commitment
+		nonces[i], c = ks.Commit(alpha)
+		commitments[i] = roundTrip(t, c, new(Commitment))
+	}
+
+	shares := make([]*SignatureShare, len(ids))
+	for i, ks := range participants {
+		share, err := ks.Sign(nonces[i], commitments)
+		if err != nil {
+			return nil, nil, err
+		}
+		shares[i] = roundTrip(t, share, new(SignatureShare))
+	}
+
+	tk := roundTrip(t, keyShares[0].ThresholdKey(), new(ThresholdKey))
+	return tk.Combine(alpha, commitments, shares)
+}
+
+// roundTrip encodes the given value and decodes it into the other.
+func roundTrip[T encoding.BinaryUnmarshaler](t *testing.T, v encoding.BinaryMarshaler, other T) T {
+	t.Helper()
+
+	b, err := v.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	return other
+}
@@ -1,4 +1,5 @@
-// Package vrf provides an implementation of RFC 9381's ECVRF-EDWARDS25519-SHA512-ELL2.
+// Package vrf provides an implementation of RFC 9381's ECVRF-EDWARDS25519-SHA512-ELL2 and
+// ECVRF-EDWARDS25519-SHA512-TAI.
 package vrf
 
 import (
@@ -8,67 +9,111 @@ import (
 	"errors"
 
 	"filippo.io/edwards25519"
-	h2c "github.com/bytemare/hash2curve/edwards25519"
 )
 
-// ErrInvalidProof is returned when a proof is invalid.
-var ErrInvalidProof = errors.New("vrf: invalid proof")
+var (
+	// ErrInvalidProof is returned when a proof is invalid.
+	ErrInvalidProof = errors.New("vrf: invalid proof")
+
+	// ErrInvalidKey is returned when a public key is invalid.
+	ErrInvalidKey = errors.New("vrf: invalid public key")
+)
 
 // VerifyingKey is a public key which is used to verify proofs created by the corresponding ProvingKey.
 type VerifyingKey struct {
 	y       *edwards25519.Point
 	encoded []byte
+	suite   Suite
+	strict  bool
+	table   *pointTable
 }
 
-// NewVerifyingKey deserializes the given byte slice into a VerifyingKey. Returns an error if the byte slice is not a
-// valid Ed25519 point.
-func NewVerifyingKey(publicKey ed25519.PublicKey) (*VerifyingKey, error) {
-	q, err := new(edwards25519.Point).SetBytes(publicKey)
+// NewVerifyingKey deserializes the given byte slice into a VerifyingKey. Returns ErrInvalidKey if the byte slice is not
+// the canonical encoding of an Ed25519 point, or, with WithStrictKey, if the point is of small order. Returns an error
+// if the suite is unknown.
+func NewVerifyingKey(publicKey ed25519.PublicKey, opts ...Option) (*VerifyingKey, error) {
+	o, err := newOptions(opts)
 	if err != nil {
 		return nil, err
 	}
-	return &VerifyingKey{y: q, encoded: publicKey}, nil
-}
 
-// Verify the given input and proof. Returns a hash of the proof if valid, ErrInvalidProof if invalid.
-func (vk *VerifyingKey) Verify(alpha, proof []byte) (hash []byte, err error) {
-	gamma, err := new(edwards25519.Point).SetBytes(proof[:32])
-	if err != nil {
-		return nil, ErrInvalidProof
+	q, ok := decodePoint(publicKey)
+	if !ok {
+		return nil, ErrInvalidKey
 	}
 
-	var buf [32]byte
-	copy(buf[:], proof[32:48])
-	c, err := new(edwards25519.Scalar).SetCanonicalBytes(buf[:])
-	if err != nil {
-		return nil, ErrInvalidProof
+	if o.strict && new(edwards25519.Point).MultByCofactor(q).Equal(edwards25519.NewIdentityPoint()) == 1 {
+		return nil, ErrInvalidKey
 	}
 
-	s, err := new(edwards25519.Scalar).SetCanonicalBytes(proof[48:])
-	if err != nil {
-		return nil, ErrInvalidProof
+	vk := &VerifyingKey{y: q, encoded: publicKey, suite: o.suite, strict: o.strict}
+	if o.precompute {
+		vk.table = newPointTable(q)
 	}
+	return vk, nil
+}
+
+// Suite returns the cipher suite of the key's proofs.
+func (vk *VerifyingKey) Suite() Suite {
+	return vk.suite
+}
 
-	h := encodeToCurve(vk.encoded, alpha)
-	u := new(edwards25519.Point).ScalarBaseMult(s)
-	u.Subtract(u, new(edwards25519.Point).ScalarMult(c, vk.y))
-	v := new(edwards25519.Point).ScalarMult(s, h)
-	v.Subtract(v, new(edwards25519.Point).ScalarMult(c, gamma))
+// Precompute returns a copy of the key with a table precomputed as by WithPrecomputedTable, or the key itself if it
+// already has one.
+func (vk *VerifyingKey) Precompute() *VerifyingKey {
+	if vk.table != nil {
+		return vk
+	}
+
+	x := *vk
+	x.table = newPointTable(vk.y)
+	return &x
+}
+
+// Verify the given input and proof. Returns a hash of the proof if valid, ErrInvalidProof if invalid or malformed.
+func (vk *VerifyingKey) Verify(alpha, proof []byte) (hash []byte, err error) {
+	p, err := ParseProof(proof)
+	if err != nil {
+		return nil, err
+	}
 
-	cP := generateChallenge(vk.y, h, gamma, u, v)
-	if c.Equal(cP) == 1 {
-		return hashProof(gamma), nil
+	// U = s*B - c*Y and V = s*H - c*Gamma. The proof is public, so variable-time multiplications are safe.
+	h := vk.suite.encodeToCurve(vk.encoded, alpha)
+	negC := new(edwards25519.Scalar).Negate(p.c)
+	u := new(edwards25519.Point)
+	if vk.table != nil {
+		u.Subtract(u.ScalarBaseMult(p.s), vk.table.varTimeMultChallenge(new(edwards25519.Point), p.c))
+	} else {
+		u.VarTimeDoubleScalarBaseMult(negC, vk.y, p.s)
 	}
+	v := new(edwards25519.Point).VarTimeMultiScalarMult([]*edwards25519.Scalar{p.s, negC}, []*edwards25519.Point{h, p.gamma})
 
-	return nil, ErrInvalidProof
+	if vk.suite.generateChallenge(vk.y.Bytes(), h.Bytes(), p.gamma.Bytes(), u.Bytes(), v.Bytes()).Equal(p.c) != 1 {
+		return nil, ErrInvalidProof
+	}
+	return ProofToHash(vk.suite, p), nil
 }
 
 func (vk *VerifyingKey) MarshalBinary() (data []byte, err error) {
 	return vk.encoded, nil
 }
 
+// UnmarshalBinary decodes the given public key. If vk already has a suite, it is kept; otherwise, ELL2 is used. If vk
+// was created with WithStrictKey, the decoded key is validated, and if vk was created with WithPrecomputedTable, a table
+// is precomputed for the decoded key.
 func (vk *VerifyingKey) UnmarshalBinary(data []byte) (err error) {
-	x, err := NewVerifyingKey(data)
+	var opts []Option
+	if vk.suite != 0 {
+		opts = append(opts, WithSuite(vk.suite))
+	}
+	if vk.strict {
+		opts = append(opts, WithStrictKey())
+	}
+	if vk.table != nil {
+		opts = append(opts, WithPrecomputedTable())
+	}
+
+	x, err := NewVerifyingKey(data, opts...)
 	if err != nil {
 		return err
 	}
@@ -92,8 +137,13 @@ type ProvingKey struct {
 }
 
 // NewProvingKey derives a ProvingKey and VerifyingKey pair from the given seed value. It will panic if len(seed) is not
-// ed25519.SeedSize.
-func NewProvingKey(key ed25519.PrivateKey) *ProvingKey {
+// ed25519.SeedSize or if the suite is unknown.
+func NewProvingKey(key ed25519.PrivateKey, opts ...Option) *ProvingKey {
+	o, err := newOptions(opts)
+	if err != nil {
+		panic(err)
+	}
+
 	hs := sha512.New()
 	hs.Write(key.Seed())
 	h := hs.Sum(nil)
@@ -110,6 +160,7 @@ func NewProvingKey(key ed25519.PrivateKey) *ProvingKey {
 		VerifyingKey: VerifyingKey{
 			y:       q,
 			encoded: key.Public().(ed25519.PublicKey),
+			suite:   o.suite,
 		},
 	}
 }
@@ -118,41 +169,17 @@ func NewProvingKey(key ed25519.PrivateKey) *ProvingKey {
 // offers no privacy guarantees with regard to the input; the hash cannot be verified but offers full privacy with
 // regard to the input.
 func (pk *ProvingKey) Prove(alpha []byte) (proof, hash []byte) {
-	h := encodeToCurve(pk.VerifyingKey.encoded, alpha)
+	suite := pk.VerifyingKey.suite
+	h := suite.encodeToCurve(pk.VerifyingKey.encoded, alpha)
 	gamma := new(edwards25519.Point).ScalarMult(pk.x, h)
 	k := generateNonce(pk.prefix, h.Bytes())
-	c := generateChallenge(pk.VerifyingKey.y, h, gamma, new(edwards25519.Point).ScalarBaseMult(k), new(edwards25519.Point).ScalarMult(k, h))
+	c := suite.generateChallenge(pk.VerifyingKey.y.Bytes(), h.Bytes(), gamma.Bytes(),
+		new(edwards25519.Point).ScalarBaseMult(k).Bytes(), new(edwards25519.Point).ScalarMult(k, h).Bytes())
 	s := new(edwards25519.Scalar).MultiplyAdd(c, pk.x, k)
-	pi := gamma.Bytes()
-	pi = append(pi, c.Bytes()[:16]...)
-	pi = append(pi, s.Bytes()...)
-	return pi, hashProof(gamma)
-}
 
-func hashProof(gamma *edwards25519.Point) []byte {
-	h := sha512.New()
-	h.Write([]byte{suite, proofDomainSeparatorFront})
-	h.Write(new(edwards25519.Point).MultByCofactor(gamma).Bytes())
-	h.Write([]byte{proofDomainSeparatorBack})
-	return h.Sum(nil)
-}
-
-func generateChallenge(p1, p2, p3, p4, p5 *edwards25519.Point) *edwards25519.Scalar {
-	h := sha512.New()
-	h.Write([]byte{suite, challengeDomainSeparatorFront})
-	h.Write(p1.Bytes())
-	h.Write(p2.Bytes())
-	h.Write(p3.Bytes())
-	h.Write(p4.Bytes())
-	h.Write(p5.Bytes())
-	h.Write([]byte{challengeDomainSeparatorBack})
-
-	cStr := append(h.Sum(nil)[:16], make([]byte, 16)...)
-	c, err := new(edwards25519.Scalar).SetCanonicalBytes(cStr)
-	if err != nil {
-		panic(err)
-	}
-	return c
+	p := &Proof{gamma: gamma, c: c, s: s}
+	proof, _ = p.MarshalBinary()
+	return proof, ProofToHash(suite, p)
 }
 
 func generateNonce(prefix, hash []byte) *edwards25519.Scalar {
@@ -165,16 +192,3 @@ func generateNonce(prefix, hash []byte) *edwards25519.Scalar {
 	}
 	return k
 }
-
-func encodeToCurve(salt, alpha []byte) *edwards25519.Point {
-	input := append(salt, alpha...)
-	return h2c.EncodeToCurve(input, []byte("ECVRF_edwards25519_XMD:SHA-512_ELL2_NU_\004"))
-}
-
-const (
-	suite                         = 0x04
-	challengeDomainSeparatorFront = 0x02
-	challengeDomainSeparatorBack  = 0x00
-	proofDomainSeparatorFront     = 0x03
-	proofDomainSeparatorBack      = 0x00
-)
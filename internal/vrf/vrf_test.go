@@ -5,6 +5,8 @@ import (
 	"crypto/ed25519"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"slices"
 	"testing"
 )
 
@@ -13,12 +15,12 @@ func TestExamples(t *testing.T) {
 		t.Run(tv.Name, func(t *testing.T) {
 			privateKey := ed25519.NewKeyFromSeed(tv.SK)
 
-			sk := NewProvingKey(privateKey)
+			sk := NewProvingKey(privateKey, WithSuite(tv.Suite))
 			if got, want := sk.VerifyingKey.encoded, tv.PK; !bytes.Equal(got, want) {
 				t.Errorf("NewProvingKey(%x) = %x, want = %x", tv.SK, got, want)
 			}
 
-			pk, err := NewVerifyingKey(tv.PK)
+			pk, err := NewVerifyingKey(tv.PK, WithSuite(tv.Suite))
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -50,7 +52,7 @@ func TestExamples(t *testing.T) {
 func TestEncodeToCurve(t *testing.T) {
 	for _, tv := range testVectors {
 		t.Run(tv.Name, func(t *testing.T) {
-			if got, want := encodeToCurve(tv.PK, tv.Alpha).Bytes(), tv.H; !bytes.Equal(got, want) {
+			if got, want := tv.Suite.encodeToCurve(tv.PK, tv.Alpha).Bytes(), tv.H; !bytes.Equal(got, want) {
 				t.Errorf("encodeToCurve(%x, %x) = %x, want %x", tv.PK, tv.Alpha, got, want)
 			}
 
@@ -58,14 +60,261 @@ func TestEncodeToCurve(t *testing.T) {
 	}
 }
 
-// https://www.ietf.org/rfc/rfc9381.html#name-ecvrf-edwards25519-sha512-t
+func TestSuites(t *testing.T) {
+	privateKey := ed25519.NewKeyFromSeed(testVectors[0].SK)
+	tai := NewProvingKey(privateKey, WithSuite(TAI))
+	ell2 := NewProvingKey(privateKey)
+
+	if got, want := ell2.VerifyingKey.Suite(), ELL2; got != want {
+		t.Errorf("Suite() = %v, want %v", got, want)
+	}
+
+	// Proofs only verify under the suite which created them.
+	pi, _ := tai.Prove([]byte("alpha"))
+	if _, err := ell2.VerifyingKey.Verify([]byte("alpha"), pi); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Verify() = %v, want ErrInvalidProof", err)
+	}
+
+	// Unmarshaling a key keeps its suite.
+	b, err := tai.VerifyingKey.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vk := &VerifyingKey{suite: TAI}
+	if err := vk.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vk.Verify([]byte("alpha"), pi); err != nil {
+		t.Errorf("Verify() = %v, want nil", err)
+	}
+
+	if _, err := NewVerifyingKey(b, WithSuite(0x05)); err == nil {
+		t.Error("created a key with an unknown suite")
+	}
+}
+
+func TestNewVerifyingKey(t *testing.T) {
+	for _, tv := range testVectors {
+		if _, err := NewVerifyingKey(tv.PK, WithStrictKey()); err != nil {
+			t.Errorf("%s: NewVerifyingKey() = %v", tv.Name, err)
+		}
+	}
+
+	for _, tv := range []struct {
+		Name   string
+		PK     []byte
+		Strict bool
+	}{
+		{Name: "short", PK: mustHexDecodeString("3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af466")},
+		{Name: "long", PK: mustHexDecodeString("3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c00")},
+		{Name: "not on curve", PK: mustHexDecodeString("0200000000000000000000000000000000000000000000000000000000000000")},
+
+		// Non-canonical encodings, which are always rejected.
+		{Name: "y = p + 3", PK: mustHexDecodeString("f0ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f")},
+		{Name: "identity, y = p + 1", PK: mustHexDecodeString("eeffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f")},
+		{Name: "identity, negative x", PK: mustHexDecodeString("0100000000000000000000000000000000000000000000000000000000000080")},
+		{Name: "order 2, negative x", PK: mustHexDecodeString("ecffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")},
+
+		// Points of small order, which are rejected in strict mode.
+		{Name: "identity", PK: mustHexDecodeString("0100000000000000000000000000000000000000000000000000000000000000"), Strict: true},
+		{Name: "order 2", PK: mustHexDecodeString("ecffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f"), Strict: true},
+		{Name: "order 4", PK: mustHexDecodeString("0000000000000000000000000000000000000000000000000000000000000000"), Strict: true},
+		{Name: "order 4, negative x", PK: mustHexDecodeString("0000000000000000000000000000000000000000000000000000000000000080"), Strict: true},
+		{Name: "order 8", PK: mustHexDecodeString("26e8958fc2b227b045c3f489f2ef98f0d5dfac05d3c63339b13802886d53fc05"), Strict: true},
+		{Name: "order 8, negative x", PK: mustHexDecodeString("26e8958fc2b227b045c3f489f2ef98f0d5dfac05d3c63339b13802886d53fc85"), Strict: true},
+		{Name: "order 8, second", PK: mustHexDecodeString("c7176a703d4dd84fba3c0b760d10670f2a2053fa2c39ccc64ec7fd7792ac037a"), Strict: true},
+		{Name: "order 8, second, negative x", PK: mustHexDecodeString("c7176a703d4dd84fba3c0b760d10670f2a2053fa2c39ccc64ec7fd7792ac03fa"), Strict: true},
+	} {
+		t.Run(tv.Name, func(t *testing.T) {
+			if _, err := NewVerifyingKey(tv.PK, WithStrictKey()); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("NewVerifyingKey(WithStrictKey()) = %v, want ErrInvalidKey", err)
+			}
+
+			_, err := NewVerifyingKey(tv.PK)
+			if tv.Strict && err != nil {
+				t.Errorf("NewVerifyingKey() = %v, want nil", err)
+			} else if !tv.Strict && !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("NewVerifyingKey() = %v, want ErrInvalidKey", err)
+			}
+		})
+	}
+
+	// Unmarshaling a key keeps its strictness.
+	vk, err := NewVerifyingKey(testVectors[0].PK, WithStrictKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vk.UnmarshalBinary(make([]byte, 32)); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("UnmarshalBinary() = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestVerifyBatch(t *testing.T) {
+	sk := NewProvingKey(ed25519.NewKeyFromSeed(testVectors[0].SK))
+	alphas, proofs, want := newTestBatch(100, sk.Prove)
+
+	hashes, err := sk.VerifyingKey.VerifyBatch(alphas, proofs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range hashes {
+		if !bytes.Equal(hashes[i], want[i]) {
+			t.Errorf("hashes[%d] = %x, want %x", i, hashes[i], want[i])
+		}
+	}
+
+	// Invalid proofs are identified, and the hashes of the valid proofs are still returned.
+	alphas[3] = []byte("something else")
+	proofs[17] = bytes.Clone(proofs[17])
+	proofs[17][0] ^= 1
+	proofs[42] = proofs[42][:79]
+	proofs[64] = bytes.Clone(proofs[64])
+	proofs[64][79] ^= 1
+	proofs[99] = bytes.Clone(proofs[98])
+
+	hashes, err = sk.VerifyingKey.VerifyBatch(alphas, proofs)
+	if !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("err = %v, want ErrInvalidProof", err)
+	}
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || !slices.Equal(batchErr.Invalid, []int{3, 17, 42, 64, 99}) {
+		t.Fatalf("err = %v, want invalid proofs [3 17 42 64 99]", err)
+	}
+	for i := range hashes {
+		if slices.Contains(batchErr.Invalid, i) {
+			want[i] = nil
+		}
+		if !bytes.Equal(hashes[i], want[i]) {
+			t.Errorf("hashes[%d] = %x, want %x", i, hashes[i], want[i])
+		}
+	}
+
+	if _, err := sk.VerifyingKey.VerifyBatch(alphas, proofs[1:]); err == nil {
+		t.Error("verified a batch with mismatched lengths")
+	}
+}
+
+func BenchmarkVerify(b *testing.B) {
+	sk := NewProvingKey(ed25519.NewKeyFromSeed(testVectors[0].SK))
+	alphas, proofs, _ := newTestBatch(64, sk.Prove)
+
+	for name, vk := range newBenchmarkKeys(b, sk) {
+		b.Run(name, func(b *testing.B) {
+			for b.Loop() {
+				for i := range proofs {
+					if _, err := vk.Verify(alphas[i], proofs[i]); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(proofs)), "ns/proof")
+		})
+	}
+}
+
+func BenchmarkVerifyBatch(b *testing.B) {
+	sk := NewProvingKey(ed25519.NewKeyFromSeed(testVectors[0].SK))
+	alphas, proofs, _ := newTestBatch(64, sk.Prove)
+
+	for name, vk := range newBenchmarkKeys(b, sk) {
+		b.Run(name, func(b *testing.B) {
+			for b.Loop() {
+				if _, err := vk.VerifyBatch(alphas, proofs); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(proofs)), "ns/proof")
+		})
+	}
+}
+
+func BenchmarkNewVerifyingKey(b *testing.B) {
+	pk := testVectors[0].PK
+
+	b.Run("plain", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := NewVerifyingKey(pk); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("precomputed", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := NewVerifyingKey(pk, WithPrecomputedTable()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// newBenchmarkKeys returns the given key's verifying key with and without a precomputed table.
+func newBenchmarkKeys(b *testing.B, sk *ProvingKey) map[string]*VerifyingKey {
+	b.Helper()
+
+	precomputed, err := NewVerifyingKey(sk.VerifyingKey.encoded, WithPrecomputedTable())
+	if err != nil {
+		b.Fatal(err)
+	}
+	return map[string]*VerifyingKey{"plain": &sk.VerifyingKey, "precomputed": precomputed}
+}
+
+// newTestBatch returns n inputs, their proofs created with the given function, and the proofs' hashes.
+func newTestBatch(n int, prove func(alpha []byte) (proof, hash []byte)) (alphas, proofs, hashes [][]byte) {
+	for i := range n {
+		alpha := []byte(fmt.Sprintf("input %d", i))
+		proof, hash := prove(alpha)
+		alphas = append(alphas, alpha)
+		proofs = append(proofs, proof)
+		hashes = append(hashes, hash)
+	}
+	return alphas, proofs, hashes
+}
+
+// https://www.rfc-editor.org/rfc/rfc9381.html#appendix-B.1 and
+// https://www.rfc-editor.org/rfc/rfc9381.html#appendix-B.2
 var testVectors = []struct {
 	Name             string
+	Suite            Suite
 	SK, PK, Alpha, X []byte
 	H, Pi, Beta      []byte
 }{
+	{
+		Name:  "Example 16",
+		Suite: TAI,
+		SK:    mustHexDecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60"),
+		PK:    mustHexDecodeString("d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"),
+		Alpha: nil,
+		X:     mustHexDecodeString("307c83864f2833cb427a2ef1c00a013cfdff2768d980c0a3a520f006904de94f"),
+		H:     mustHexDecodeString("91bbed02a99461df1ad4c6564a5f5d829d0b90cfc7903e7a5797bd658abf3318"),
+		Pi:    mustHexDecodeString("8657106690b5526245a92b003bb079ccd1a92130477671f6fc01ad16f26f723f26f8a57ccaed74ee1b190bed1f479d9727d2d0f9b005a6e456a35d4fb0daab1268a1b0db10836d9826a528ca76567805"),
+		Beta:  mustHexDecodeString("90cf1df3b703cce59e2a35b925d411164068269d7b2d29f3301c03dd757876ff66b71dda49d2de59d03450451af026798e8f81cd2e333de5cdf4f3e140fdd8ae"),
+	},
+	{
+		Name:  "Example 17",
+		Suite: TAI,
+		SK:    mustHexDecodeString("4ccd089b28ff96da9db6c346ec114e0f5b8a319f35aba624da8cf6ed4fb8a6fb"),
+		PK:    mustHexDecodeString("3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c"),
+		Alpha: mustHexDecodeString("72"),
+		X:     mustHexDecodeString("68bd9ed75882d52815a97585caf4790a7f6c6b3b7f821c5e259a24b02e502e51"),
+		H:     mustHexDecodeString("5b659fc3d4e9263fd9a4ed1d022d75eaacc20df5e09f9ea937502396598dc551"),
+		Pi:    mustHexDecodeString("f3141cd382dc42909d19ec5110469e4feae18300e94f304590abdced48aed5933bf0864a62558b3ed7f2fea45c92a465301b3bbf5e3e54ddf2d935be3b67926da3ef39226bbc355bdc9850112c8f4b02"),
+		Beta:  mustHexDecodeString("eb4440665d3891d668e7e0fcaf587f1b4bd7fbfe99d0eb2211ccec90496310eb5e33821bc613efb94db5e5b54c70a848a0bef4553a41befc57663b56373a5031"),
+	},
+	{
+		Name:  "Example 18",
+		Suite: TAI,
+		SK:    mustHexDecodeString("c5aa8df43f9f837bedb7442f31dcb7b166d38535076f094b85ce3a2e0b4458f7"),
+		PK:    mustHexDecodeString("fc51cd8e6218a1a38da47ed00230f0580816ed13ba3303ac5deb911548908025"),
+		Alpha: mustHexDecodeString("af82"),
+		X:     mustHexDecodeString("909a8b755ed902849023a55b15c23d11ba4d7f4ec5c2f51b1325a181991ea95c"),
+		H:     mustHexDecodeString("bf4339376f5542811de615e3313d2b36f6f53c0acfebb482159711201192576a"),
+		Pi:    mustHexDecodeString("9bc0f79119cc5604bf02d23b4caede71393cedfbb191434dd016d30177ccbf8096bb474e53895c362d8628ee9f9ea3c0e52c7a5c691b6c18c9979866568add7a2d41b00b05081ed0f58ee5e31b3a970e"),
+		Beta:  mustHexDecodeString("645427e5d00c62a23fb703732fa5d892940935942101e456ecca7bb217c61c452118fec1219202a0edcf038bb6373241578be7217ba85a2687f7a0310b2df19f"),
+	},
 	{
 		Name:  "Example 19",
+		Suite: ELL2,
 		SK:    mustHexDecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60"),
 		PK:    mustHexDecodeString("d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"),
 		Alpha: nil,
@@ -76,6 +325,7 @@ var testVectors = []struct {
 	},
 	{
 		Name:  "Example 20",
+		Suite: ELL2,
 		SK:    mustHexDecodeString("4ccd089b28ff96da9db6c346ec114e0f5b8a319f35aba624da8cf6ed4fb8a6fb"),
 		PK:    mustHexDecodeString("3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c"),
 		Alpha: mustHexDecodeString("72"),
@@ -87,6 +337,7 @@ var testVectors = []struct {
 
 	{
 		Name:  "Example 21",
+		Suite: ELL2,
 		SK:    mustHexDecodeString("c5aa8df43f9f837bedb7442f31dcb7b166d38535076f094b85ce3a2e0b4458f7"),
 		PK:    mustHexDecodeString("fc51cd8e6218a1a38da47ed00230f0580816ed13ba3303ac5deb911548908025"),
 		Alpha: mustHexDecodeString("af82"),